@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/auth"
+	"strings"
+	"time"
+)
+
+// acl manages the acl policy of the cluster:
+// acl add|remove -type p|g <rule fields...>
+// acl list
+func acl(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: acl add|remove|list [flags] [rule fields]")
+	}
+
+	fs := flag.NewFlagSet("acl", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of a cluster node")
+	ptype := fs.String("type", auth.PolicyType, "rule type, p for a policy, g for a role or p2 for a quota")
+	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	client := v1.NewAdminClient(cc)
+	req := &v1.PolicyRequest{
+		Rule: &v1.PolicyRule{Type: *ptype, Rule: fs.Args()},
+	}
+
+	var res *v1.PolicyResponse
+	switch args[0] {
+	case "add":
+		res, err = client.AddPolicy(ctx, req)
+	case "remove":
+		res, err = client.RemovePolicy(ctx, req)
+	case "list":
+		list, err := client.ListPolicies(ctx, &v1.ListPoliciesRequest{})
+		if err != nil {
+			return err
+		}
+
+		for _, r := range list.Rules {
+			fmt.Printf("%s, %s\n", r.Type, strings.Join(r.Rule, ", "))
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown acl operation: %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("stored at offset %d\n", res.Offset)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// audit prints the events of the audit log with the auditor certificate:
+// audit -offset <offset> -max <events>
+func audit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of a cluster node")
+	offset := fs.Uint64("offset", 0, "offset of the first event")
+	max := fs.Uint("max", 100, "maximum number of events, 0 for all")
+	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	creds, err := nodeCredentials("auditor")
+	if err != nil {
+		return err
+	}
+
+	cc, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	res, err := v1.NewAdminClient(cc).ReadAudit(ctx, &v1.ReadAuditRequest{
+		Offset:    *offset,
+		MaxEvents: uint32(*max),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range res.Events {
+		fmt.Printf("%s %s %s %s %s %s %s %s\n",
+			e.Time.AsTime().Format(time.RFC3339),
+			e.Decision, e.Subject, e.Action, e.Object, e.Peer, e.Method, e.Error,
+		)
+	}
+	fmt.Printf("next offset: %d\n", res.NextOffset)
+
+	return nil
+}
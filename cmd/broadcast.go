@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// broadcast executes a command on every member of the cluster.
+func broadcast(args []string) error {
+	fs := flag.NewFlagSet("broadcast", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of a cluster node")
+	name := fs.String("name", "", "name of the command, e.g. roll-segment or truncate")
+	cmdArgs := fs.String("args", "", "arguments of the command")
+	noWait := fs.Bool("no-wait", false, "don't wait for the results")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for the results")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout+5*time.Second)
+	defer cancel()
+
+	res, err := v1.NewAdminClient(cc).Broadcast(ctx, &v1.BroadcastRequest{
+		Name:    *name,
+		Args:    []byte(*cmdArgs),
+		NoWait:  *noWait,
+		Timeout: durationpb.New(*timeout),
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tOUTPUT\tERROR")
+	for _, r := range res.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Node, r.Output, r.Error)
+	}
+
+	return w.Flush()
+}
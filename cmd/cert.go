@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/config"
+	"logger/internal/service/pki"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cert bootstraps the certificates of a cluster without cfssl:
+// cert init -cn <ca name> [-force]
+// cert issue -profile server|client|peer -cn <name> -hosts <host,...> [-force]
+// cert csr -cn <name> -hosts <host,...> -out <csr file>
+// cert sign -csr <csr file> -profile server|client|peer -out <cert file>
+// cert revoke|unrevoke -serial <hex serial> or -cert <cert file>
+// cert revoked
+// The files are the ones of the node of GOLOG_CONFIG and the GOLOG_*
+// variables, e.g. <data dir>/tls/ca.pem.
+func cert(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: cert init|issue|csr|sign|revoke|unrevoke|revoked [flags]")
+	}
+
+	fs := flag.NewFlagSet("cert", flag.ExitOnError)
+	cn := fs.String("cn", "", "common name of the certificate, the subject of a client")
+	hosts := fs.String("hosts", "", "comma separated DNS names, IP addresses and URIs")
+	profile := fs.String("profile", string(pki.ClientProfile), "usage: server, client or peer")
+	ttl := fs.Duration("ttl", pki.DefaultTTL, "validity of the certificate")
+	certFile := fs.String("cert", "", "certificate file, derived from the profile and name when empty")
+	keyFile := fs.String("key", "", "key file, derived from the profile and name when empty")
+	csrFile := fs.String("csr", "", "certificate request to sign")
+	out := fs.String("out", "", "output file of the csr or the signed certificate")
+	force := fs.Bool("force", false, "overwrite an existing CA or certificate")
+	serial := fs.String("serial", "", "hex serial number of the certificate to revoke")
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of a cluster node")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	// the files are written where the node loads them
+	c, err := config.LoadFiles()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.TLS.CAFile), 0700); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "init":
+		if _, err := os.Stat(c.TLS.CAFile); err == nil && !*force {
+			return fmt.Errorf("%s already exists, use -force to replace the CA", c.TLS.CAFile)
+		}
+
+		name := *cn
+		if name == "" {
+			name = "golog CA"
+		}
+
+		if _, err := pki.InitCA(c.TLS.CAFile, c.CAKeyFile(), name, *ttl); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s and %s\n", c.TLS.CAFile, c.CAKeyFile())
+	case "issue":
+		ca, err := pki.LoadCA(c.TLS.CAFile, c.CAKeyFile())
+		if err != nil {
+			return err
+		}
+
+		p := pki.Profile(*profile)
+		if *certFile == "" || *keyFile == "" {
+			*certFile, *keyFile = certFiles(c, p, *cn)
+		}
+
+		for _, file := range []string{*certFile, *keyFile} {
+			if _, err := os.Stat(file); err == nil && !*force {
+				return fmt.Errorf("%s already exists, use -force to replace it", file)
+			}
+		}
+
+		err = ca.Issue(pki.Request{
+			CommonName: *cn,
+			Hosts:      splitList(*hosts),
+			Profile:    p,
+			TTL:        *ttl,
+		}, *certFile, *keyFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s and %s\n", *certFile, *keyFile)
+	case "csr":
+		if *keyFile == "" || *out == "" {
+			return fmt.Errorf("csr needs -key and -out")
+		}
+
+		csr, err := pki.CreateCSR(*cn, splitList(*hosts), *keyFile)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(*out, csr, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s and %s\n", *out, *keyFile)
+	case "sign":
+		if *csrFile == "" || *out == "" {
+			return fmt.Errorf("sign needs -csr and -out")
+		}
+
+		ca, err := pki.LoadCA(c.TLS.CAFile, c.CAKeyFile())
+		if err != nil {
+			return err
+		}
+
+		csr, err := os.ReadFile(*csrFile)
+		if err != nil {
+			return err
+		}
+
+		signed, err := ca.SignCSR(csr, pki.Request{
+			CommonName: *cn,
+			Hosts:      splitList(*hosts),
+			Profile:    pki.Profile(*profile),
+			TTL:        *ttl,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(*out, signed, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s\n", *out)
+	case "revoke", "unrevoke", "revoked":
+		return revoke(args[0], *addr, *serial, *certFile)
+	default:
+		return fmt.Errorf("unknown cert operation: %q", args[0])
+	}
+
+	return nil
+}
+
+// certFiles returns the files the node and its clients load,
+// e.g. tls/server.pem, tls/peer.pem or tls/root-client.pem.
+func certFiles(c *config.Server, profile pki.Profile, cn string) (string, string) {
+	switch profile {
+	case pki.ServerProfile:
+		return c.TLS.CertFile, c.TLS.KeyFile
+	case pki.PeerProfile:
+		return c.TLS.PeerCertFile, c.TLS.PeerKeyFile
+	}
+
+	return c.ClientFiles(cn)
+}
+
+// splitList splits a comma separated list.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, ",")
+}
+
+// revoke manages the revoked certificates of the cluster.
+func revoke(op, addr, serial, certFile string) error {
+	if serial == "" && certFile != "" {
+		b, err := os.ReadFile(certFile)
+		if err != nil {
+			return err
+		}
+
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return fmt.Errorf("no certificate in %q", certFile)
+		}
+
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		serial = c.SerialNumber.Text(16)
+	}
+
+	cc, err := dial(addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := v1.NewAdminClient(cc)
+	req := &v1.RevokeRequest{Serial: serial}
+
+	var res *v1.RevokeResponse
+	switch op {
+	case "revoke":
+		res, err = client.Revoke(ctx, req)
+	case "unrevoke":
+		res, err = client.Unrevoke(ctx, req)
+	default:
+		list, err := client.ListRevoked(ctx, &v1.ListRevokedRequest{})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range list.Serials {
+			fmt.Println(s)
+		}
+
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, r := range res.Results {
+		if r.Error != "" {
+			fmt.Printf("%s: error: %s\n", r.Node, r.Error)
+			continue
+		}
+		fmt.Printf("%s: %s %s\n", r.Node, r.Output, serial)
+	}
+
+	return nil
+}
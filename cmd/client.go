@@ -0,0 +1,63 @@
+package main
+
+import (
+	"logger/internal/service/authn"
+	"logger/internal/service/config"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// environment variables of the token credentials,
+// they are sent along with the client certificate
+const (
+	tokenEnv  = "GOLOG_TOKEN"
+	apiKeyEnv = "GOLOG_API_KEY"
+)
+
+// dial connects to a node with the root client certificate.
+func dial(addr string) (*grpc.ClientConn, error) {
+	creds, err := nodeCredentials("root")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+
+	token, apiKey := os.Getenv(tokenEnv), os.Getenv(apiKeyEnv)
+	if token != "" || apiKey != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(authn.PerRPCCredentials{
+			Token:  token,
+			APIKey: apiKey,
+		}))
+	}
+
+	return grpc.NewClient(addr, opts...)
+}
+
+// nodeCredentials loads the credentials of a client whose certificate
+// is next to the CA of the node, see config.LoadFiles.
+func nodeCredentials(name string) (credentials.TransportCredentials, error) {
+	c, err := config.LoadFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	certFile, keyFile := c.ClientFiles(name)
+	return clientCredentials(certFile, keyFile, c.TLS.CAFile)
+}
+
+// clientCredentials loads the transport credentials of a client.
+func clientCredentials(certFile, keyFile, caFile string) (credentials.TransportCredentials, error) {
+	tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		CAFile:   caFile,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	v1 "logger/gen/go/v1"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// decommission drains a node and removes its log directory
+// once a replica holds all of its records.
+func decommission(args []string) error {
+	fs := flag.NewFlagSet("decommission", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of the node")
+	dir := fs.String("dir", "", "log directory to remove, nothing is removed when empty")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long to wait for replicas to catch up")
+	force := fs.Bool("force", false, "leave even if the replicas didn't catch up")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	// leave some time for the node to answer after the drain timeout
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout+time.Minute)
+	defer cancel()
+
+	res, err := v1.NewAdminClient(cc).Drain(ctx, &v1.DrainRequest{
+		Timeout: durationpb.New(*timeout),
+		Force:   *force,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "next offset: %d, consumers behind: %d\n", res.NextOffset, res.ConsumersBehind)
+	fmt.Fprintln(w, "REPLICA\tRPC ADDR\tNEXT OFFSET\tCAUGHT UP\tERROR")
+	for _, r := range res.Replicas {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%t\t%s\n", r.Name, r.RpcAddr, r.NextOffset, r.CaughtUp, r.Error)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !res.Left {
+		return fmt.Errorf("replicas didn't catch up, the node is still a member and accepts records again")
+	}
+	log.Println("Node left the cluster")
+
+	if *dir == "" {
+		return nil
+	}
+
+	if !res.SafeToRemove {
+		return fmt.Errorf("no replica holds all the records, keeping %s", *dir)
+	}
+
+	log.Println("Removing ", *dir)
+	return os.RemoveAll(*dir)
+}
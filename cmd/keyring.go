@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"os"
+	"sort"
+	"time"
+)
+
+// keyring manages the gossip encryption keys of the cluster:
+// keyring install|use|remove|list -key <base64 key>
+func keyring(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: keyring install|use|remove|list [flags]")
+	}
+
+	fs := flag.NewFlagSet("keyring", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of a cluster node")
+	key := fs.String("key", "", "base64 encoded gossip encryption key")
+	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	client := v1.NewAdminClient(cc)
+	req := &v1.KeyRequest{Key: *key}
+
+	var res *v1.KeyResponse
+	switch args[0] {
+	case "install":
+		res, err = client.InstallKey(ctx, req)
+	case "use":
+		res, err = client.UseKey(ctx, req)
+	case "remove":
+		res, err = client.RemoveKey(ctx, req)
+	case "list":
+		res, err = client.ListKeys(ctx, &v1.ListKeysRequest{})
+	default:
+		return fmt.Errorf("unknown keyring operation: %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d/%d nodes responded, %d failed\n", res.NumResp, res.NumNodes, res.NumErr)
+	for _, k := range sortedKeys(res.Keys) {
+		primary := ""
+		if res.PrimaryKeys[k] > 0 {
+			primary = fmt.Sprintf(" (primary on %d)", res.PrimaryKeys[k])
+		}
+		fmt.Printf("%s installed on %d%s\n", k, res.Keys[k], primary)
+	}
+	for _, node := range sortedKeys(res.Messages) {
+		fmt.Printf("%s: %s\n", node, res.Messages[node])
+	}
+
+	if res.Error != "" {
+		fmt.Fprintln(os.Stderr, res.Error)
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// logAdmin manages the log of a node:
+// log describe
+// log roll
+// log truncate <lowest offset>
+// log create-topic|delete-topic <topic>
+func logAdmin(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: log describe|roll|truncate|create-topic|delete-topic [flags] [args]")
+	}
+
+	fs := flag.NewFlagSet("log", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of the node")
+	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	client := v1.NewAdminClient(cc)
+
+	switch args[0] {
+	case "describe":
+		res, err := client.DescribeLog(ctx, &v1.DescribeLogRequest{})
+		if err != nil {
+			return err
+		}
+
+		return printLog(res)
+	case "roll":
+		res, err := client.RollSegment(ctx, &v1.RollSegmentRequest{})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("active segment starts at %d\n", res.BaseOffset)
+	case "truncate":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: log truncate [flags] <lowest offset>")
+		}
+		lowest, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		res, err := client.Truncate(ctx, &v1.TruncateRequest{LowestOffset: lowest})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("lowest offset is %d\n", res.LowestOffset)
+	case "create-topic", "delete-topic":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: log %s [flags] <topic>", args[0])
+		}
+
+		change := client.CreateTopic
+		if args[0] == "delete-topic" {
+			change = client.DeleteTopic
+		}
+
+		res, err := change(ctx, &v1.TopicRequest{Topic: fs.Arg(0)})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("stored at offset %d\n", res.Offset)
+	default:
+		return fmt.Errorf("unknown log operation: %q", args[0])
+	}
+
+	return nil
+}
+
+// printLog prints the offsets, segments and topics of a log.
+func printLog(res *v1.DescribeLogResponse) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "lowest offset: %d, highest offset: %d\n", res.LowestOffset, res.HighestOffset)
+
+	fmt.Fprintln(w, "BASE OFFSET\tNEXT OFFSET\tSTORE BYTES\tINDEX FILL\tACTIVE")
+	for _, s := range res.Segments {
+		fill := 0.0
+		if s.MaxIndexBytes > 0 {
+			fill = 100 * float64(s.IndexBytes) / float64(s.MaxIndexBytes)
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%.1f%%\t%t\n", s.BaseOffset, s.NextOffset, s.StoreBytes, fill, s.Active)
+	}
+
+	if len(res.Topics) > 0 {
+		fmt.Fprintln(w, "TOPIC\tCREATED AT\tDELETED AT")
+		for _, t := range res.Topics {
+			deleted := "-"
+			if t.Deleted {
+				deleted = strconv.FormatUint(t.DeletedAt, 10)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", t.Name, t.CreatedAt, deleted)
+		}
+	}
+
+	return w.Flush()
+}
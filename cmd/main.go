@@ -2,42 +2,37 @@ package main
 
 import (
 	"log"
-	v1 "logger/gen/go/v1"
-	"logger/internal/service/config"
-	logger "logger/internal/service/log"
+	"os"
 )
 
-func main() {
-	l, err := logger.New("./logs", &config.Config{
-		Segment: config.Segment{
-			MaxStoreBytes: 1024,
-			MaxIndexBytes: 1024,
-			InitialOffset: 0,
-		},
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.Println(l.Dir)
-
-	defer l.Close()
+// commands are the subcommands of the binary,
+// without one it serves with the flags given
+var commands = map[string]func(args []string) error{
+	"serve":        serve,
+	"config":       printConfig,
+	"reload":       reload,
+	"status":       status,
+	"verify":       verify,
+	"mirror":       runMirror,
+	"keyring":      keyring,
+	"decommission": decommission,
+	"broadcast":    broadcast,
+	"acl":          acl,
+	"token":        token,
+	"audit":        audit,
+	"cert":         cert,
+	"log":          logAdmin,
+}
 
-	log.Println("Appending record")
-	off, err := l.Append(&v1.Record{
-		Value: []byte(`{"foo": "bar"}`),
-	})
-	if err != nil {
-		log.Fatal("Failed to append record: ", err)
+func main() {
+	cmd, args := serve, os.Args[1:]
+	if len(args) > 0 {
+		if c, ok := commands[args[0]]; ok {
+			cmd, args = c, args[1:]
+		}
 	}
 
-	log.Println("Record appended at offset: ", off)
-
-	record, err := l.Read(off)
-	if err != nil {
-		log.Fatal("Failed to read record: ", err)
+	if err := cmd(args); err != nil {
+		log.Fatal(err)
 	}
-
-	log.Printf("Record: %v\n", record)
-	log.Println("Done")
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"logger/internal/service/config"
+	"logger/internal/service/mirror"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc"
+)
+
+// runMirror mirrors topics from a source cluster to a target cluster
+// until it is interrupted.
+func runMirror(args []string) error {
+	// the certificates default to the ones next to the node
+	c, err := config.LoadFiles()
+	if err != nil {
+		return err
+	}
+	rootCert, rootKey := c.ClientFiles("root")
+	mirrorCert, mirrorKey := c.ClientFiles("mirror")
+
+	fs := flag.NewFlagSet("mirror", flag.ExitOnError)
+	source := fs.String("source", "", "rpc address of the source cluster")
+	sourceCA := fs.String("source-ca", c.TLS.CAFile, "CA of the source cluster")
+	sourceCert := fs.String("source-cert", rootCert, "client certificate for the source cluster")
+	sourceKey := fs.String("source-key", rootKey, "client key for the source cluster")
+	target := fs.String("target", "", "rpc address of the target cluster")
+	targetCA := fs.String("target-ca", c.TLS.CAFile, "CA of the target cluster")
+	targetCert := fs.String("target-cert", mirrorCert, "client certificate for the target cluster")
+	targetKey := fs.String("target-key", mirrorKey, "client key for the target cluster")
+	topics := fs.String("topics", "", "comma separated topics to mirror, every topic when empty")
+	dir := fs.String("dir", "./mirror", "directory of the offset translations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sourceCreds, err := clientCredentials(*sourceCert, *sourceKey, *sourceCA)
+	if err != nil {
+		return err
+	}
+
+	targetCreds, err := clientCredentials(*targetCert, *targetKey, *targetCA)
+	if err != nil {
+		return err
+	}
+
+	var allowed []string
+	if *topics != "" {
+		allowed = strings.Split(*topics, ",")
+	}
+
+	m, err := mirror.New(mirror.Config{
+		SourceAddr:        *source,
+		SourceDialOptions: []grpc.DialOption{grpc.WithTransportCredentials(sourceCreds)},
+		TargetAddr:        *target,
+		TargetDialOptions: []grpc.DialOption{grpc.WithTransportCredentials(targetCreds)},
+		Topics:            allowed,
+		Dir:               *dir,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Mirroring %s to %s from offset %d", *source, *target, m.Offsets.Next())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	return m.Close()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"time"
+)
+
+// reload makes a node apply the changes of its configuration file,
+// like sending it a SIGHUP.
+func reload(args []string) error {
+	fs := flag.NewFlagSet("reload", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of the node")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := v1.NewAdminClient(cc).ReloadConfig(ctx, &v1.ReloadConfigRequest{})
+	if err != nil {
+		return err
+	}
+
+	if len(res.Applied) == 0 {
+		fmt.Println("no changes")
+	}
+	for _, key := range res.Applied {
+		fmt.Printf("applied %s\n", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"logger/internal/agent"
+	"logger/internal/service/config"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// serve runs a node until it's interrupted:
+// serve -config <file> [-<setting> <value>...]
+func serve(args []string) error {
+	c, err := config.LoadServer("serve", args)
+	if err != nil {
+		return err
+	}
+
+	a, err := agent.New(c)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("golog: %s serving on %s", c.NodeName, c.RPC.BindAddr)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigc {
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		// reload the configuration and keep serving
+		if _, err := a.Reload(); err != nil {
+			log.Printf("[ERROR] golog: config not reloaded: %s", err)
+		}
+	}
+
+	return a.Shutdown()
+}
+
+// printConfig prints the effective configuration of a node:
+// config -config <file> [-<setting> <value>...]
+func printConfig(args []string) error {
+	c, err := config.LoadServer("config", args)
+	if err != nil {
+		return err
+	}
+
+	return c.Print(os.Stdout)
+}
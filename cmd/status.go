@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// status prints the cluster status reported by a node.
+func status(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of a cluster node")
+	local := fs.Bool("local", false, "only report the node itself")
+	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	res, err := v1.NewLogClient(cc).ClusterStatus(
+		ctx,
+		&v1.ClusterStatusRequest{Local: *local},
+	)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tRPC ADDR\tHIGHEST OFFSET\tTAGS\tERROR")
+	for _, m := range res.Members {
+		name := m.Name
+		if m.Local {
+			name += " (local)"
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			name, m.Status, m.RpcAddr, m.HighestOffset, tags(m.Tags), m.Error,
+		)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "MEMBER\tSOURCE\tNEXT OFFSET\tSOURCE HIGHEST\tLAG")
+	for _, m := range res.Members {
+		for _, r := range m.Replication {
+			fmt.Fprintf(
+				w, "%s\t%s\t%d\t%d\t%d\n",
+				m.Name, r.Source, r.NextOffset, r.SourceHighestOffset, r.Lag,
+			)
+		}
+	}
+
+	return w.Flush()
+}
+
+// tags formats the tags as sorted key=value pairs.
+func tags(t map[string]string) string {
+	pairs := make([]string, 0, len(t))
+	for k, v := range t {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
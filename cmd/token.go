@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"logger/internal/service/authn"
+	"time"
+)
+
+// token issues credentials for clients without certificates:
+// token sign -keyset <file> -kid <key id> -subject <subject>
+// token apikey
+func token(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: token sign|apikey [flags]")
+	}
+
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	keySet := fs.String("keyset", "", "key set file of the signing keys")
+	kid := fs.String("kid", "", "id of the signing key")
+	subject := fs.String("subject", "", "subject of the token")
+	ttl := fs.Duration("ttl", time.Hour, "lifetime of the token")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "sign":
+		keys, err := authn.LoadKeySet(*keySet)
+		if err != nil {
+			return err
+		}
+
+		key, ok := keys[*kid]
+		if !ok {
+			return fmt.Errorf("unknown key: %q", *kid)
+		}
+
+		now := time.Now()
+		t, err := authn.Sign(*kid, key, authn.Claims{
+			Subject:   *subject,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(*ttl).Unix(),
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(t)
+	case "apikey":
+		key, hash, err := authn.GenerateAPIKey()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("key:  %s\nhash: %s\n", key, hash)
+	default:
+		return fmt.Errorf("unknown token operation: %q", args[0])
+	}
+
+	return nil
+}
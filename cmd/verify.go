@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// verify asks a node to compare its log with its peers.
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8400", "rpc address of the verifying node")
+	peer := fs.String("peer", "", "rpc address of the peer, every peer when empty")
+	repair := fs.Bool("repair", false, "fetch the divergent records again from the peer")
+	timeout := fs.Duration("timeout", time.Minute, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cc, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	res, err := v1.NewLogClient(cc).Verify(
+		ctx,
+		&v1.VerifyRequest{RpcAddr: *peer, Repair: *repair},
+	)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tRANGE\tCONSISTENT\tFIRST DIVERGENT\tREPAIRED\tERROR")
+	for _, v := range res.Verifications {
+		divergent := "-"
+		if !v.Consistent {
+			divergent = fmt.Sprint(v.FirstDivergentOffset)
+		}
+		fmt.Fprintf(
+			w, "%s\t[%d, %d)\t%t\t%s\t%t\t%s\n",
+			v.RpcAddr, v.StartOffset, v.EndOffset,
+			v.Consistent, divergent, v.Repaired, v.Error,
+		)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+)
+
+// levels in increasing order of severity
+var levels = map[string]int{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+}
+
+// tags mark the level of a line, serf tags its errors [ERR]
+var tags = []struct {
+	tag   []byte
+	level int
+}{
+	{[]byte("[DEBUG]"), 0},
+	{[]byte("[INFO]"), 1},
+	{[]byte("[WARN]"), 2},
+	{[]byte("[ERR]"), 3},
+	{[]byte("[ERROR]"), 3},
+}
+
+// levelWriter drops the log lines below the level.
+// A line's level is read from its [DEBUG], [INFO], [WARN]
+// or [ERROR] tag, untagged lines are always written.
+type levelWriter struct {
+	out   io.Writer
+	level atomic.Int32
+}
+
+func newLevelWriter(out io.Writer, level string) *levelWriter {
+	w := &levelWriter{out: out}
+	w.SetLevel(level)
+	return w
+}
+
+// SetLevel changes the lowest level written.
+func (self *levelWriter) SetLevel(level string) {
+	self.level.Store(int32(levels[level]))
+}
+
+func (self *levelWriter) Write(p []byte) (int, error) {
+	for _, t := range tags {
+		if bytes.Contains(p, t.tag) {
+			if int32(t.level) < self.level.Load() {
+				return len(p), nil
+			}
+			break
+		}
+	}
+
+	return self.out.Write(p)
+}
@@ -0,0 +1,527 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/audit"
+	"logger/internal/service/auth"
+	"logger/internal/service/authn"
+	"logger/internal/service/config"
+	"logger/internal/service/discovery"
+	logger "logger/internal/service/log"
+	"logger/internal/service/quota"
+	"logger/internal/service/revocation"
+	"logger/internal/transport/rpc"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+/*
+This package assembles a node from its configuration:
+the log, the ACL, the authenticators, the gRPC server,
+discovery and the replication between the nodes.
+The components are set up in dependency order and
+shut down in the reverse order.
+*/
+
+const (
+	// policyFollowInterval is how often the replicated acl changes are applied
+	policyFollowInterval = time.Second
+	// retentionInterval is how often the retention of the log is enforced
+	retentionInterval = time.Minute
+	// gatewayReadHeaderTimeout bounds the time to read the headers of a request
+	gatewayReadHeaderTimeout = 10 * time.Second
+	// gatewayShutdownTimeout bounds the time to finish the requests on shutdown
+	gatewayShutdownTimeout = 5 * time.Second
+)
+
+// Agent runs the components of a node.
+type Agent struct {
+	Config *config.Server
+
+	log         *logger.Log
+	auditLog    *logger.Log
+	auditor     *audit.Auditor
+	authorizer  *auth.Authorizer
+	revocations *revocation.List
+	server      *grpc.Server
+	discovery   discovery.Discovery
+	replicator  *logger.Replicator
+	verifier    *logger.Verifier
+	peerConn    *grpc.ClientConn
+	rpcConfig   *rpc.Config
+	serverTLS   *tls.Config
+	listener    net.Listener
+	gateway     *http.Server
+	output      *levelWriter
+	// stops publishing the membership in the health checks
+	unfollow func()
+
+	mu       sync.Mutex
+	shutdown bool
+}
+
+// New sets up the node and starts serving.
+func New(c *config.Server) (*Agent, error) {
+	a := &Agent{Config: c}
+
+	a.output = newLevelWriter(log.Writer(), c.LogLevel)
+	log.SetOutput(a.output)
+
+	setup := []func() error{
+		a.setupLog,
+		a.setupAuth,
+		a.setupServer,
+		a.setupGateway,
+		a.setupDiscovery,
+		a.serve,
+		a.ready,
+	}
+	for _, fn := range setup {
+		if err := fn(); err != nil {
+			a.Shutdown()
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+func (self *Agent) setupLog() error {
+	var err error
+	self.log, err = openLog(self.Config.LogDir(), self.Config.NodeName, self.Config.Segment)
+	if err != nil {
+		return err
+	}
+
+	self.log.SetRetention(logRetention(self.Config.Retention))
+	self.log.RetainEvery(retentionInterval)
+
+	if !self.Config.Audit.Enabled {
+		return nil
+	}
+
+	self.auditLog, err = openLog(filepath.Join(self.Config.DataDir, "audit"), self.Config.NodeName, self.Config.Segment)
+	if err != nil {
+		return err
+	}
+
+	self.auditor = audit.New(audit.Config{
+		Log: self.auditLog,
+		Retention: audit.Retention{
+			MaxAge:     time.Duration(self.Config.Audit.MaxAge),
+			MaxRecords: self.Config.Audit.MaxRecords,
+		},
+	})
+
+	return nil
+}
+
+func (self *Agent) setupAuth() error {
+	var err error
+	self.authorizer, err = auth.New(self.Config.ACL.ModelFile, self.Config.ACL.PolicyFile)
+	if err != nil {
+		return err
+	}
+
+	if interval := time.Duration(self.Config.ACL.WatchInterval); interval > 0 {
+		self.authorizer.Watch(interval)
+	}
+
+	if err := self.authorizer.Follow(self.log, self.Config.NodeName, policyFollowInterval); err != nil {
+		return err
+	}
+
+	self.revocations, err = revocation.New(self.Config.TLS.CRLFile, self.Config.TLS.RevokedFile)
+
+	return err
+}
+
+func (self *Agent) setupServer() error {
+	authenticators, err := authn.New(self.authnConfig())
+	if err != nil {
+		return err
+	}
+
+	serverTLS, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:           self.Config.TLS.CertFile,
+		KeyFile:            self.Config.TLS.KeyFile,
+		CAFile:             self.Config.TLS.CAFile,
+		Server:             true,
+		OptionalClientCert: self.Config.TLS.OptionalClientCert,
+	})
+	if err != nil {
+		return err
+	}
+
+	// no ServerAddress, each connection verifies the server
+	// against the host of the peer it dials
+	peerTLS, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: self.Config.TLS.PeerCertFile,
+		KeyFile:  self.Config.TLS.PeerKeyFile,
+		CAFile:   self.Config.TLS.CAFile,
+	})
+	if err != nil {
+		return err
+	}
+	dialOptions := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(peerTLS))}
+
+	replicatorSubject, err := peerSubject(peerTLS, self.authnConfig().Identity)
+	if err != nil {
+		return err
+	}
+
+	rpcConfig := &rpc.Config{
+		CommitLog:         self.log,
+		Logs:              self.log,
+		Authorize:         self.authorizer,
+		Policy:            self.authorizer,
+		Revocations:       self.revocations,
+		Reloader:          self,
+		Authenticators:    authenticators,
+		Quota:             quota.New(self.authorizer),
+		DialOptions:       dialOptions,
+		ReplicatorSubject: replicatorSubject,
+	}
+	if self.auditor != nil {
+		rpcConfig.Audit = self.auditor
+	}
+
+	// the replicator produces the records of the other nodes locally
+	self.peerConn, err = grpc.NewClient(localAddr(self.Config.RPC.BindAddr), dialOptions...)
+	if err != nil {
+		return err
+	}
+	self.replicator = &logger.Replicator{
+		DialOptions: dialOptions,
+		LocalServer: v1.NewLogClient(self.peerConn),
+		Log:         self.log,
+	}
+	rpcConfig.Replication = self.replicator
+
+	self.verifier = &logger.Verifier{
+		DialOptions: dialOptions,
+		Log:         self.log,
+		Interval:    time.Duration(self.Config.Verify.Interval),
+		Repair:      self.Config.Verify.Repair,
+		Replicator:  self.replicator,
+	}
+	rpcConfig.Verifier = self.verifier
+
+	// discovery fills in the rest before serving
+	self.rpcConfig = rpcConfig
+
+	self.server, err = rpc.New(rpcConfig, grpc.Creds(credentials.NewTLS(serverTLS)))
+	if err != nil {
+		return err
+	}
+
+	// listen before discovery, so the replicator can connect
+	// while the connections wait to be served
+	self.listener, err = net.Listen("tcp", self.Config.RPC.BindAddr)
+	if err != nil {
+		return err
+	}
+
+	self.serverTLS = serverTLS
+
+	return nil
+}
+
+// setupGateway serves produce and consume over HTTP/JSON,
+// with the TLS settings of the rpc server.
+func (self *Agent) setupGateway() error {
+	if self.Config.HTTP.BindAddr == "" {
+		return nil
+	}
+
+	ln, err := tls.Listen("tcp", self.Config.HTTP.BindAddr, self.serverTLS)
+	if err != nil {
+		return err
+	}
+
+	self.gateway = &http.Server{
+		Handler:           rpc.NewGateway(self.rpcConfig),
+		ReadHeaderTimeout: gatewayReadHeaderTimeout,
+	}
+	go func() {
+		if err := self.gateway.Serve(ln); err != http.ErrServerClosed {
+			log.Printf("[ERROR] golog: http gateway stopped: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+func (self *Agent) setupDiscovery() error {
+	c := self.Config.Discovery
+	handler := handlers{self.replicator, self.verifier}
+
+	var err error
+	switch c.Backend {
+	case config.SerfBackend:
+		var m *discovery.Membership
+		m, err = discovery.New(handler, discovery.Config{
+			NodeName:       self.Config.NodeName,
+			BindAddr:       c.BindAddr,
+			RPCAddr:        self.Config.RPC.BindAddr,
+			Role:           discovery.Role(c.Role),
+			Rack:           c.Rack,
+			Zone:           c.Zone,
+			StartJoinAddrs: c.StartJoinAddrs,
+			EncryptKey:     c.EncryptKey,
+			KeyringFile:    self.Config.KeyringFile(),
+			LogOutput:      self.output,
+		})
+		if err != nil {
+			return err
+		}
+		self.discovery = m
+
+		for _, commands := range []map[string]discovery.CommandHandler{
+			self.log.Commands(),
+			self.authorizer.Commands(),
+			self.revocations.Commands(),
+		} {
+			for name, fn := range commands {
+				m.Register(name, fn)
+			}
+		}
+
+		self.rpcConfig.Cluster = m
+		self.rpcConfig.Keyring = m
+		self.rpcConfig.Membership = m
+		self.rpcConfig.Commands = m
+	case config.StaticBackend:
+		self.discovery, err = discovery.NewStatic(handler, discovery.StaticConfig{
+			NodeName: self.Config.NodeName,
+			RPCAddr:  self.Config.RPC.BindAddr,
+			Path:     c.StaticFile,
+			Interval: time.Duration(c.Interval),
+		})
+	case config.DNSBackend:
+		self.discovery, err = discovery.NewDNS(handler, discovery.DNSConfig{
+			NodeName: self.Config.NodeName,
+			RPCAddr:  self.Config.RPC.BindAddr,
+			Service:  c.DNSService,
+			Proto:    c.DNSProto,
+			Name:     c.DNSName,
+			Resolver: c.DNSResolver,
+			Interval: time.Duration(c.Interval),
+		})
+	}
+
+	return err
+}
+
+// serve accepts the connections of the clients and the other nodes.
+func (self *Agent) serve() error {
+	go func() {
+		if err := self.server.Serve(self.listener); err != nil {
+			log.Printf("[ERROR] golog: rpc server stopped: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+// ready publishes the node as joined while it's a live member
+// of the cluster, the log is served from then on.
+func (self *Agent) ready() error {
+	self.unfollow = self.rpcConfig.FollowMembership()
+	return nil
+}
+
+// authnConfig returns the authenticators enabled by the config.
+func (self *Agent) authnConfig() authn.Config {
+	c := authn.Config{
+		MTLS:        self.Config.Authn.MTLS,
+		KeySetFile:  self.Config.Authn.KeySetFile,
+		APIKeysFile: self.Config.Authn.APIKeysFile,
+		Revocations: self.revocations,
+		Identity: authn.IdentityConfig{
+			Formats: self.Config.Authn.IdentityFormats,
+		},
+	}
+
+	for _, r := range self.Config.Authn.IdentityRules {
+		match, replace, _ := strings.Cut(r, "=>")
+		c.Identity.Rules = append(c.Identity.Rules, authn.Rule{
+			Match:   strings.TrimSpace(match),
+			Replace: strings.TrimSpace(replace),
+		})
+	}
+
+	return c
+}
+
+// peerSubject returns the subject the server authenticates
+// the peer certificate as.
+func peerSubject(peerTLS *tls.Config, identity authn.IdentityConfig) (string, error) {
+	if peerTLS.GetClientCertificate == nil {
+		return "", nil
+	}
+
+	cert, err := peerTLS.GetClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		return "", err
+	}
+	if len(cert.Certificate) == 0 {
+		return "", nil
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+
+	mapper, err := authn.NewIdentityMapper(identity)
+	if err != nil {
+		return "", err
+	}
+
+	return mapper.Identity(leaf)
+}
+
+// Shutdown leaves the cluster and stops the components.
+func (self *Agent) Shutdown() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.shutdown {
+		return nil
+	}
+	self.shutdown = true
+
+	if self.unfollow != nil {
+		self.unfollow()
+	}
+	if self.rpcConfig != nil {
+		// stop probes from routing to the node first
+		self.rpcConfig.SetJoined(false)
+		self.rpcConfig.SetLogOpen(false)
+	}
+
+	var shutdown []func() error
+	if self.discovery != nil {
+		shutdown = append(shutdown, self.discovery.Leave)
+	}
+	if self.replicator != nil {
+		shutdown = append(shutdown, self.replicator.Close, self.verifier.Close)
+	}
+	if self.gateway != nil {
+		shutdown = append(shutdown, func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), gatewayShutdownTimeout)
+			defer cancel()
+
+			return self.gateway.Shutdown(ctx)
+		})
+	}
+	if self.server != nil {
+		shutdown = append(shutdown, func() error {
+			self.server.GracefulStop()
+			return nil
+		})
+	}
+	if self.listener != nil {
+		// GracefulStop closes the listener once it's served
+		shutdown = append(shutdown, func() error {
+			self.listener.Close()
+			return nil
+		})
+	}
+	if self.peerConn != nil {
+		shutdown = append(shutdown, self.peerConn.Close)
+	}
+	if self.authorizer != nil {
+		shutdown = append(shutdown, self.authorizer.Close)
+	}
+	if self.auditor != nil {
+		shutdown = append(shutdown, self.auditor.Close, self.auditLog.Close)
+	}
+	if self.log != nil {
+		shutdown = append(shutdown, self.log.Close)
+	}
+
+	for _, fn := range shutdown {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openLog opens the log of the directory, creating it if needed.
+func openLog(dir, node string, segment config.Segment) (*logger.Log, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return logger.New(dir, &config.Config{NodeName: node, Segment: segment})
+}
+
+// logRetention returns the retention of the log of the config.
+func logRetention(c config.RetentionConfig) logger.Retention {
+	return logger.Retention{
+		MaxAge:     time.Duration(c.MaxAge),
+		MaxRecords: c.MaxRecords,
+	}
+}
+
+// localAddr returns the address to dial the server of the node,
+// the loopback when it binds every interface.
+func localAddr(bindAddr string) string {
+	h, port, err := net.SplitHostPort(bindAddr)
+	if err != nil {
+		return bindAddr
+	}
+
+	if ip := net.ParseIP(h); h == "" || ip != nil && ip.IsUnspecified() {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return bindAddr
+}
+
+// handlers drives every handler with the discovered nodes.
+type handlers []discovery.Handler
+
+func (self handlers) Join(node discovery.Node) error {
+	var errs []string
+	for _, h := range self {
+		if err := h.Join(node); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to join %s: %s", node.Name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (self handlers) Leave(node discovery.Node) error {
+	var errs []string
+	for _, h := range self {
+		if err := h.Leave(node); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to leave %s: %s", node.Name, strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"log"
+	"logger/internal/service/audit"
+	"logger/internal/service/config"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// live are the settings applied without a restart
+var live = map[string]bool{
+	"log_level":               true,
+	"segment.max_store_bytes": true,
+	"segment.max_index_bytes": true,
+	"retention.max_age":       true,
+	"retention.max_records":   true,
+	"audit.max_age":           true,
+	"audit.max_records":       true,
+}
+
+// Reload reads the configuration again and applies the changed settings.
+// The reload is rejected as a whole when a changed setting needs a restart.
+// The acl files are reloaded as well, they hold the quotas.
+// It returns the keys of the applied settings.
+func (self *Agent) Reload() ([]string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.shutdown {
+		return nil, status.Error(codes.Unavailable, "agent is shut down")
+	}
+
+	c, err := self.Config.Reload()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	changed := config.Diff(self.Config, c)
+
+	var restart []string
+	for _, key := range changed {
+		if !live[key] {
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"%s: needs a restart, nothing was applied",
+			strings.Join(restart, ", "),
+		)
+	}
+
+	if err := self.authorizer.Reload(); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "acl: %s", err)
+	}
+
+	self.output.SetLevel(c.LogLevel)
+	self.log.SetSegment(c.Segment)
+	self.log.SetRetention(logRetention(c.Retention))
+	if self.auditor != nil {
+		self.auditLog.SetSegment(c.Segment)
+		self.auditor.SetRetention(audit.Retention{
+			MaxAge:     time.Duration(c.Audit.MaxAge),
+			MaxRecords: c.Audit.MaxRecords,
+		})
+	}
+	self.Config = c
+
+	for _, key := range changed {
+		log.Printf("[INFO] golog: reloaded %s", key)
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/auth"
+	"logger/internal/service/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// reloadable returns an agent with the log and the acl of the config
+// file, the other components aren't needed to reload.
+func reloadable(t *testing.T, path string) *Agent {
+	t.Helper()
+
+	c, err := config.LoadServer("serve", []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Agent{Config: c, output: newLevelWriter(io.Discard, c.LogLevel)}
+	if a.log, err = openLog(c.LogDir(), c.NodeName, c.Segment); err != nil {
+		t.Fatal(err)
+	}
+	if a.authorizer, err = auth.New(c.ACL.ModelFile, c.ACL.PolicyFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.authorizer.Close()
+		a.log.Close()
+	})
+
+	return a
+}
+
+// nodeConfig writes the config of a node with the settings appended.
+func nodeConfig(t *testing.T, path, dir, settings string) {
+	t.Helper()
+
+	content := `node_name: node-1
+data_dir: ` + dir + `
+acl:
+  model_file: ../../test/model.conf
+  policy_file: ../../test/policy.csv
+` + settings
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dataDir creates a data dir with the certificate files,
+// they must exist but aren't read by the reload.
+func dataDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "tls"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"server.pem", "server-key.pem", "ca.pem", "peer.pem", "peer-key.pem"} {
+		if err := os.WriteFile(filepath.Join(dir, "tls", f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestReloadAppliesLiveSettings(t *testing.T) {
+	dir := dataDir(t)
+	path := filepath.Join(t.TempDir(), "node.yaml")
+	nodeConfig(t, path, dir, "")
+	a := reloadable(t, path)
+	if _, err := a.log.Append(&v1.Record{Value: []byte("before")}); err != nil {
+		t.Fatal(err)
+	}
+
+	nodeConfig(t, path, dir, `log_level: error
+segment:
+  max_store_bytes: 4096
+  max_index_bytes: 36
+retention:
+  max_records: 2
+`)
+
+	changed, err := a.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"log_level", "retention.max_records", "segment.max_index_bytes", "segment.max_store_bytes"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Fatalf("got changed %v, want %v", changed, want)
+	}
+	if a.Config.LogLevel != "error" || a.log.Config.Segment.MaxIndexBytes != 36 {
+		t.Fatalf("the settings weren't applied: %+v", a.Config)
+	}
+
+	// the segments rolled from now on hold 3 records
+	if _, err := a.log.Roll(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if _, err := a.log.Append(&v1.Record{Value: []byte("after")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if segments := a.log.Segments(); len(segments) != 4 {
+		t.Fatalf("got segments %+v, want 4", segments)
+	}
+
+	// the 2 last records are in the segment at 4
+	if err := a.log.Retain(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if lowest, _ := a.log.LowestOffset(); lowest != 4 {
+		t.Fatalf("got lowest offset %d, want 4", lowest)
+	}
+}
+
+func TestReloadRejectsRestartSettings(t *testing.T) {
+	dir := dataDir(t)
+	path := filepath.Join(t.TempDir(), "node.yaml")
+	nodeConfig(t, path, dir, "")
+	a := reloadable(t, path)
+
+	// a live setting is changed with one that needs a restart
+	nodeConfig(t, path, dir, `log_level: error
+rpc:
+  bind_addr: 127.0.0.1:9400
+`)
+
+	_, err := a.Reload()
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("got %v, want FailedPrecondition", err)
+	}
+	if a.Config.LogLevel != "info" || a.Config.RPC.BindAddr != "127.0.0.1:8400" {
+		t.Fatalf("the reload was applied in part: %+v", a.Config)
+	}
+}
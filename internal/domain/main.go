@@ -4,3 +4,33 @@ type Record struct {
 	Value  []byte `json:"value"`
 	Offset uint64 `json:"offset"`
 }
+
+// Peer is the replication state of a source node
+type Peer struct {
+	Name string `json:"name"`
+	Addr string `json:"addr"`
+	// next offset of the source log to be replicated
+	NextOffset uint64 `json:"next_offset"`
+}
+
+// Segment describes a segment of the log
+type Segment struct {
+	BaseOffset uint64 `json:"base_offset"`
+	// offset of the next record appended to the segment
+	NextOffset uint64 `json:"next_offset"`
+	StoreBytes uint64 `json:"store_bytes"`
+	IndexBytes uint64 `json:"index_bytes"`
+	// size of the index file, the segment rolls once it's full
+	MaxIndexBytes uint64 `json:"max_index_bytes"`
+	Active        bool   `json:"active"`
+}
+
+// Topic is a topic created explicitly
+type Topic struct {
+	Name string `json:"name"`
+	// offset of the record creating the topic
+	CreatedAt uint64 `json:"created_at"`
+	Deleted   bool   `json:"deleted"`
+	// offset of the record deleting the topic
+	DeletedAt uint64 `json:"deleted_at"`
+}
@@ -91,3 +91,35 @@ func (self *FileStorage) Read(pos uint64) ([]byte, error) {
 	// return the record
 	return body, nil
 }
+
+// Shrink function removes everything from the position onwards
+func (self *FileStorage) Shrink(pos uint64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	err := self.buf.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = self.File.Truncate(int64(pos))
+	if err != nil {
+		return err
+	}
+
+	self.Size = pos
+	return nil
+}
+
+// Close function flushes the buffered records and closes the file
+func (self *FileStorage) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	err := self.buf.Flush()
+	if err != nil {
+		return err
+	}
+
+	return self.File.Close()
+}
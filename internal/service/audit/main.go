@@ -0,0 +1,238 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	v1 "logger/gen/go/v1"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+This package writes the audit log: every authorization decision
+and every admin call as a JSON event. The events go to a dedicated
+log, apart from the records of the clients, that is only appended to
+and truncated by its own retention. It is read through the Admin service
+by the subjects allowed to read the audit object.
+*/
+
+// Topic is the topic of the audit records.
+const Topic = "__audit"
+
+// decisions of the events
+const (
+	Allow = "allow"
+	Deny  = "deny"
+	Error = "error"
+)
+
+// Event is an entry of the audit log.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Subject  string    `json:"subject"`
+	Action   string    `json:"action"`
+	Object   string    `json:"object"`
+	Peer     string    `json:"peer,omitempty"`
+	Method   string    `json:"method,omitempty"`
+	Decision string    `json:"decision"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// CommitLog stores the events.
+type CommitLog interface {
+	Append(*v1.Record) (uint64, error)
+	Read(uint64) (*v1.Record, error)
+	LowestOffset() (uint64, error)
+	HighestOffset() (uint64, error)
+	Truncate(lowest uint64) error
+}
+
+// Retention bounds the audit log, a zero limit is not enforced.
+type Retention struct {
+	// MaxAge of the events kept
+	MaxAge time.Duration
+	// MaxRecords kept
+	MaxRecords uint64
+	// Interval between the retention checks
+	Interval time.Duration
+}
+
+// Config is used to configure the Auditor.
+type Config struct {
+	Log       CommitLog
+	Retention Retention
+}
+
+// Auditor appends the events to the audit log.
+type Auditor struct {
+	Config
+
+	mu     sync.Mutex
+	closed bool
+	close  chan struct{}
+}
+
+// New creates an auditor and starts enforcing the retention.
+func New(config Config) *Auditor {
+	if config.Retention.Interval == 0 {
+		config.Retention.Interval = time.Minute
+	}
+
+	a := &Auditor{
+		Config: config,
+		close:  make(chan struct{}),
+	}
+
+	go a.retain()
+
+	return a
+}
+
+// SetRetention changes the limits enforced from the next check on.
+func (self *Auditor) SetRetention(retention Retention) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if retention.Interval == 0 {
+		retention.Interval = self.Retention.Interval
+	}
+	self.Retention = retention
+}
+
+// retention returns the limits in effect.
+func (self *Auditor) retention() Retention {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.Retention
+}
+
+// Record appends the event. An event that can't be written
+// is logged, it never fails the audited call.
+func (self *Auditor) Record(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	value, err := json.Marshal(event)
+	if err == nil {
+		_, err = self.Log.Append(&v1.Record{Value: value, Topic: Topic})
+	}
+	if err != nil {
+		log.Printf("[ERROR] golog: failed to record audit event: %s", err)
+	}
+}
+
+// Read returns up to max events from the offset
+// and the offset of the next event.
+func (self *Auditor) Read(offset uint64, max int) ([]Event, uint64, error) {
+	lowest, err := self.Log.LowestOffset()
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset < lowest {
+		offset = lowest
+	}
+
+	var events []Event
+	for max <= 0 || len(events) < max {
+		record, err := self.Log.Read(offset)
+		if err != nil {
+			// the end of the log
+			break
+		}
+
+		var event Event
+		if err := json.Unmarshal(record.Value, &event); err != nil {
+			return nil, 0, err
+		}
+
+		events = append(events, event)
+		offset++
+	}
+
+	return events, offset, nil
+}
+
+// retain truncates the log on every interval until the auditor is closed.
+func (self *Auditor) retain() {
+	ticker := time.NewTicker(self.retention().Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-self.close:
+			return
+		case <-ticker.C:
+			if err := self.truncate(time.Now()); err != nil {
+				log.Printf("[ERROR] golog: failed to truncate audit log: %s", err)
+			}
+		}
+	}
+}
+
+// truncate removes the events beyond the retention limits.
+func (self *Auditor) truncate(now time.Time) error {
+	retention := self.retention()
+	if retention.MaxAge == 0 && retention.MaxRecords == 0 {
+		return nil
+	}
+
+	lowest, err := self.Log.LowestOffset()
+	if err != nil {
+		return err
+	}
+	highest, err := self.Log.HighestOffset()
+	if err != nil {
+		return err
+	}
+
+	// the first offset to keep
+	keep := lowest
+	if max := retention.MaxRecords; max > 0 && highest+1-lowest > max {
+		keep = highest + 1 - max
+	}
+
+	if retention.MaxAge > 0 {
+		expired := now.Add(-retention.MaxAge)
+
+		// the events are appended in time order
+		n := int(highest + 1 - keep)
+		keep += uint64(sort.Search(n, func(i int) bool {
+			record, err := self.Log.Read(keep + uint64(i))
+			if err != nil {
+				return true
+			}
+
+			var event Event
+			if err := json.Unmarshal(record.Value, &event); err != nil {
+				return true
+			}
+
+			return event.Time.After(expired)
+		}))
+	}
+
+	if keep == lowest {
+		return nil
+	}
+
+	// whole segments below the first kept event are removed
+	return self.Log.Truncate(keep)
+}
+
+// Close stops enforcing the retention.
+func (self *Auditor) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return nil
+	}
+
+	self.closed = true
+	close(self.close)
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memLog keeps the records in memory, it can only be appended to
+// and truncated.
+type memLog struct {
+	mu      sync.Mutex
+	lowest  uint64
+	records []*v1.Record
+}
+
+func (self *memLog) Append(record *v1.Record) (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	record.Offset = self.lowest + uint64(len(self.records))
+	self.records = append(self.records, record)
+
+	return record.Offset, nil
+}
+
+func (self *memLog) Read(offset uint64) (*v1.Record, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if offset < self.lowest || offset >= self.lowest+uint64(len(self.records)) {
+		return nil, status.Errorf(codes.OutOfRange, "offset out of range: %d", offset)
+	}
+	return self.records[offset-self.lowest], nil
+}
+
+func (self *memLog) LowestOffset() (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.lowest, nil
+}
+
+func (self *memLog) HighestOffset() (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.records) == 0 {
+		return self.lowest, nil
+	}
+	return self.lowest + uint64(len(self.records)) - 1, nil
+}
+
+// Truncate removes the records below lowest, one record per segment.
+func (self *memLog) Truncate(lowest uint64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for len(self.records) > 0 && self.lowest < lowest {
+		self.records = self.records[1:]
+		self.lowest++
+	}
+
+	return nil
+}
+
+// subjects returns the subjects of the events of the log.
+func subjects(t *testing.T, a *Auditor) string {
+	t.Helper()
+
+	events, _, err := a.Read(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Subject)
+	}
+	return fmt.Sprint(got)
+}
+
+func TestRecordAppends(t *testing.T) {
+	l := &memLog{}
+	a := New(Config{Log: l})
+	defer a.Close()
+
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	a.Record(Event{Time: at, Subject: "alice", Action: "produce", Object: "topic/orders", Decision: Allow})
+	a.Record(Event{Subject: "bob", Action: "consume", Object: "topic/orders", Decision: Deny})
+	a.Record(Event{Subject: "carol", Action: "call", Object: "cluster", Decision: Error, Error: "failed"})
+
+	events, next, err := a.Read(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || next != 2 {
+		t.Fatalf("got %d events up to %d, want 2 up to 2", len(events), next)
+	}
+	if !events[0].Time.Equal(at) || events[0].Subject != "alice" {
+		t.Fatalf("got %+v, want the event of alice", events[0])
+	}
+	// the time of the call is set when it's missing
+	if events[1].Time.IsZero() {
+		t.Fatalf("got %+v without a time", events[1])
+	}
+
+	events, next, err = a.Read(next, 10)
+	if err != nil || len(events) != 1 || next != 3 || events[0].Error != "failed" {
+		t.Fatalf("got %+v up to %d, %v, want the event of carol", events, next, err)
+	}
+
+	// every event is a record of the audit topic
+	for _, r := range l.records {
+		var e Event
+		if r.Topic != Topic || json.Unmarshal(r.Value, &e) != nil {
+			t.Fatalf("got record %+v", r)
+		}
+	}
+
+	// the events removed by the retention aren't read
+	l.Truncate(1)
+	if got := subjects(t, a); got != "[bob carol]" {
+		t.Fatalf("got %s, want [bob carol]", got)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		retention Retention
+		want      string
+	}{
+		{"unlimited", Retention{}, "[e0 e1 e2 e3 e4]"},
+		{"max records", Retention{MaxRecords: 2}, "[e3 e4]"},
+		{"more records than the log", Retention{MaxRecords: 10}, "[e0 e1 e2 e3 e4]"},
+		{"max age", Retention{MaxAge: 150 * time.Minute}, "[e3 e4]"},
+		{"every event expired", Retention{MaxAge: time.Minute}, "[]"},
+		{"the lower of both limits", Retention{MaxAge: 4 * time.Hour, MaxRecords: 3}, "[e2 e3 e4]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(Config{Log: &memLog{}, Retention: tt.retention})
+			defer a.Close()
+
+			// one event per hour, the last one an hour ago
+			for i := 0; i < 5; i++ {
+				a.Record(Event{
+					Time:     now.Add(time.Duration(i-5) * time.Hour),
+					Subject:  fmt.Sprintf("e%d", i),
+					Decision: Allow,
+				})
+			}
+
+			if err := a.truncate(now); err != nil {
+				t.Fatal(err)
+			}
+			if got := subjects(t, a); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+
+			// the events recorded later are kept
+			a.Record(Event{Time: now, Subject: "new", Decision: Allow})
+			if err := a.truncate(now); err != nil {
+				t.Fatal(err)
+			}
+			events, _, _ := a.Read(0, 0)
+			if len(events) == 0 || events[len(events)-1].Subject != "new" {
+				t.Fatalf("got %+v, want the new event last", events)
+			}
+		})
+	}
+}
+
+func TestSetRetention(t *testing.T) {
+	now := time.Now()
+	a := New(Config{Log: &memLog{}, Retention: Retention{Interval: time.Hour}})
+	defer a.Close()
+
+	for i := 0; i < 3; i++ {
+		a.Record(Event{Time: now, Subject: fmt.Sprintf("e%d", i), Decision: Allow})
+	}
+
+	a.SetRetention(Retention{MaxRecords: 1})
+	if got := a.retention().Interval; got != time.Hour {
+		t.Fatalf("got interval %s, want the current one", got)
+	}
+
+	if err := a.truncate(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects(t, a); got != "[e2]" {
+		t.Fatalf("got %s, want [e2]", got)
+	}
+}
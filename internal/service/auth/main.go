@@ -1,21 +1,73 @@
 package auth
 
-import "github.com/casbin/casbin"
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin"
+	"github.com/casbin/casbin/util"
+)
+
+// anyName stands for the names matched by the wildcards of the policy
+const anyName = "_"
 
 type Authorizer struct {
+	modelPath  string
+	policyPath string
+
+	mu       sync.RWMutex
 	enforcer *casbin.Enforcer
+	version  Version
+	modTimes [2]time.Time
+	// latest change of each rule made at runtime,
+	// replayed when the files are reloaded
+	rules map[string]policyEntry
+	// time of the latest change seen, see tick
+	clock int64
+	// name of the node stamped on its changes
+	node string
+
+	// follow serializes reading the policy log
+	follow sync.Mutex
+	log    PolicyLog
+	next   uint64
+
+	close chan struct{}
 }
 
-func New(modelPath, policyPath string) *Authorizer {
-	enforcer := casbin.NewEnforcer(modelPath, policyPath)
+// New loads the model and policy files.
+func New(modelPath, policyPath string) (*Authorizer, error) {
+	enforcer, err := loadEnforcer(modelPath, policyPath)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Authorizer{
-		enforcer: enforcer,
+	a := &Authorizer{
+		modelPath:  modelPath,
+		policyPath: policyPath,
+		enforcer:   enforcer,
+		rules:      make(map[string]policyEntry),
+		close:      make(chan struct{}),
 	}
+	a.version.Number = 1
+	a.version.LoadedAt = time.Now()
+	// casbin loads no rules from a missing policy file
+	a.version.Checksum, err = checksum(modelPath, policyPath)
+	if err != nil {
+		return nil, err
+	}
+	a.modTimes, _ = modTimes(modelPath, policyPath)
+
+	return a, nil
 }
 
 func (a *Authorizer) Authorize(subject, object, action string) error {
-	if !a.enforcer.Enforce(subject, object, action) {
+	a.mu.RLock()
+	ok := a.enforcer.Enforce(subject, object, action)
+	a.mu.RUnlock()
+
+	if !ok {
 		return ErrPermissionDenied{
 			subject: subject,
 			object:  object,
@@ -25,3 +77,37 @@ func (a *Authorizer) Authorize(subject, object, action string) error {
 
 	return nil
 }
+
+// AuthorizeAny checks that the subject may do the action on at least
+// one of the objects starting with the prefix, for the calls that
+// learn their objects later. Each object the policy could grant
+// is checked, so the roles and denies apply as for Authorize.
+func (a *Authorizer) AuthorizeAny(subject, prefix, action string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, rule := range a.enforcer.GetPolicy() {
+		if len(rule) < 2 {
+			continue
+		}
+
+		// an object matched by the rule, under the prefix
+		object := strings.ReplaceAll(rule[1], "*", anyName)
+		if !strings.HasPrefix(object, prefix) {
+			if !util.KeyMatch(prefix+anyName, rule[1]) {
+				continue
+			}
+			object = prefix + anyName
+		}
+
+		if a.enforcer.Enforce(subject, object, action) {
+			return nil
+		}
+	}
+
+	return ErrPermissionDenied{
+		subject: subject,
+		object:  prefix + "*",
+		action:  action,
+	}.Status().Err()
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testPolicy = `p, consumer, topic/*, consume, allow
+p, orders, topic/orders-*, consume, allow
+p, blocked, topic/*, consume, allow
+p, blocked, topic/*, consume, deny
+p, admin, *, *, allow
+p, auditor, audit, read, allow
+g, root, admin
+g, alice, orders
+`
+
+func TestAuthorizeAny(t *testing.T) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "policy.csv")
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New("../../../test/model.conf", policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject string
+		action  string
+		want    codes.Code
+	}{
+		{subject: "consumer", action: "consume", want: codes.OK},
+		// a grant on some topics is enough
+		{subject: "alice", action: "consume", want: codes.OK},
+		{subject: "root", action: "consume", want: codes.OK},
+		{subject: "consumer", action: "produce", want: codes.PermissionDenied},
+		// a grant on other objects isn't
+		{subject: "auditor", action: "consume", want: codes.PermissionDenied},
+		{subject: "blocked", action: "consume", want: codes.PermissionDenied},
+		{subject: "nobody", action: "consume", want: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject+"/"+tt.action, func(t *testing.T) {
+			err := a.AuthorizeAny(tt.subject, "topic/", tt.action)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("got %s, want %s: %v", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPolicyGrantsReplication(t *testing.T) {
+	a, err := New("../../../test/model.conf", "../../../test/policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject string
+		object  string
+		action  string
+		want    codes.Code
+	}{
+		// the replicator produces locally what it consumes from the peers
+		{subject: "peer", object: "topic/orders", action: "produce", want: codes.OK},
+		{subject: "peer", object: "topic/orders", action: "consume", want: codes.OK},
+		// system topics are produced and consumed with the admin action
+		{subject: "peer", object: "topic/__acl", action: "admin", want: codes.OK},
+		{subject: "peer", object: "topic/__topics", action: "admin", want: codes.OK},
+		// the verifier compares checksums, the drain asks for the progress
+		{subject: "peer", object: "log", action: "describe", want: codes.OK},
+		{subject: "peer", object: "cluster", action: "describe", want: codes.OK},
+		{subject: "peer", object: "topic/orders", action: "admin", want: codes.PermissionDenied},
+		{subject: "peer", object: "log", action: "admin", want: codes.PermissionDenied},
+		{subject: "peer", object: "acl", action: "admin", want: codes.PermissionDenied},
+		{subject: "nobody", object: "topic/orders", action: "produce", want: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject+"/"+tt.object+"/"+tt.action, func(t *testing.T) {
+			err := a.Authorize(tt.subject, tt.object, tt.action)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("got %s, want %s: %v", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/casbin/casbin"
+)
+
+/*
+Quotas are rules of the policy, next to the ACLs:
+p2, <subject or role>, <produce|consume>, <records/sec>, <bytes/sec>
+A zero limit is unlimited. The quota of the subject itself wins
+over the quotas of its roles, the closest role first.
+*/
+
+// QuotaType is the type of the quota rules
+const QuotaType = "p2"
+
+// Quota returns the records and bytes per second allowed to the subject
+// for the operation. It reports false when no quota applies.
+func (a *Authorizer) Quota(subject, op string) (records, bytes float64, ok bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	// a model without quotas
+	if _, defined := a.enforcer.GetModel()["p"][QuotaType]; !defined {
+		return 0, 0, false
+	}
+
+	names := append([]string{subject}, a.enforcer.GetImplicitRolesForUser(subject)...)
+	for _, name := range names {
+		for _, rule := range a.enforcer.GetFilteredNamedPolicy(QuotaType, 0, name, op) {
+			records, bytes, err := parseQuota(rule)
+			if err != nil {
+				continue
+			}
+
+			return records, bytes, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// parseQuota returns the limits of a quota rule.
+func parseQuota(rule []string) (records, bytes float64, err error) {
+	if len(rule) != 4 {
+		return 0, 0, fmt.Errorf("quota rule needs 4 fields, got %d", len(rule))
+	}
+
+	records, err = strconv.ParseFloat(rule[2], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	bytes, err = strconv.ParseFloat(rule[3], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return records, bytes, nil
+}
+
+// removeNamedPolicy removes a rule without panicking,
+// casbin has no safe variant of it.
+func removeNamedPolicy(enforcer *casbin.Enforcer, ptype string, rule []string) (ok bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return enforcer.RemoveNamedPolicy(ptype, rule), nil
+}
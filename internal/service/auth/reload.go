@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"logger/internal/service/discovery"
+	"os"
+	"time"
+
+	"github.com/casbin/casbin"
+)
+
+// Version identifies the loaded policy.
+type Version struct {
+	// Number is incremented on every successful reload
+	Number   uint64
+	LoadedAt time.Time
+	// Checksum of the model and policy files,
+	// equal on nodes that loaded the same files
+	Checksum string
+	// LastError is why the last reload failed, empty if it didn't
+	LastError string
+}
+
+// Watch reloads the model and policy files when they change.
+func (a *Authorizer) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.close:
+				return
+			case <-ticker.C:
+				times, err := modTimes(a.modelPath, a.policyPath)
+				if err != nil {
+					log.Printf("[ERROR] golog: failed to stat acl files: %s", err)
+					continue
+				}
+
+				a.mu.RLock()
+				changed := times != a.modTimes
+				a.mu.RUnlock()
+
+				if !changed {
+					continue
+				}
+
+				if err := a.Reload(); err != nil {
+					log.Printf("[ERROR] golog: keeping the current acl policy: %s", err)
+
+					// retry once the files change again
+					a.mu.Lock()
+					a.modTimes = times
+					a.mu.Unlock()
+				}
+			}
+		}
+	}()
+}
+
+// Reload loads the model and policy files and swaps them in at once.
+// The current policy is kept if the new one fails to load.
+func (a *Authorizer) Reload() error {
+	times, err := modTimes(a.modelPath, a.policyPath)
+	if err != nil {
+		return a.failed(err)
+	}
+
+	sum, err := checksum(a.modelPath, a.policyPath)
+	if err != nil {
+		return a.failed(err)
+	}
+
+	enforcer, err := loadEnforcer(a.modelPath, a.policyPath)
+	if err != nil {
+		return a.failed(err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// keep the changes made at runtime,
+	// each rule has a single one in effect so the order doesn't matter
+	for _, entry := range a.rules {
+		if err := apply(enforcer, entry.change); err != nil {
+			log.Printf("[ERROR] golog: failed to replay acl change %v: %s", entry.change, err)
+		}
+	}
+
+	a.enforcer = enforcer
+	a.modTimes = times
+	a.version = Version{
+		Number:   a.version.Number + 1,
+		LoadedAt: time.Now(),
+		Checksum: sum,
+	}
+
+	return nil
+}
+
+// loadEnforcer loads the model and policy files,
+// returning an error where casbin would panic.
+func loadEnforcer(modelPath, policyPath string) (*casbin.Enforcer, error) {
+	enforcer, err := casbin.NewEnforcerSafe(modelPath, policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// the policy changes are stored in the log, not in the files
+	enforcer.EnableAutoSave(false)
+
+	// the matcher is only evaluated on enforce
+	_, err = enforcer.EnforceSafe("", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return enforcer, nil
+}
+
+// Commands returns the cluster-wide commands of the authorizer.
+func (a *Authorizer) Commands() map[string]discovery.CommandHandler {
+	return map[string]discovery.CommandHandler{
+		"reload-acl": func(args []byte) (string, error) {
+			if err := a.Reload(); err != nil {
+				return "", err
+			}
+
+			v := a.Version()
+			return fmt.Sprintf("policy version %d (%s)", v.Number, v.Checksum), nil
+		},
+	}
+}
+
+// Version returns the version of the loaded policy.
+func (a *Authorizer) Version() Version {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.version
+}
+
+// Close stops watching the files.
+func (a *Authorizer) Close() error {
+	close(a.close)
+	return nil
+}
+
+// failed records why a reload failed.
+func (a *Authorizer) failed(err error) error {
+	err = fmt.Errorf("failed to reload acl: %w", err)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.version.LastError = err.Error()
+
+	return err
+}
+
+// checksum hashes the content of the files.
+func checksum(paths ...string) (string, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// modTimes returns the modification times of the model and policy files.
+func modTimes(modelPath, policyPath string) ([2]time.Time, error) {
+	var times [2]time.Time
+	for i, path := range []string{modelPath, policyPath} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return times, err
+		}
+		times[i] = fi.ModTime()
+	}
+
+	return times, nil
+}
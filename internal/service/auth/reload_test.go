@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewRejectsBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	policy := write("policy.csv", testPolicy)
+	brokenModel := write("broken.conf", "[request_definition]\nr = sub, obj, act\n[matchers]\nm = unknown(r.sub)\n")
+
+	tests := []struct {
+		name       string
+		modelPath  string
+		policyPath string
+	}{
+		{"missing model", filepath.Join(dir, "missing.conf"), policy},
+		{"missing policy", "../../../test/model.conf", filepath.Join(dir, "missing.csv")},
+		{"broken matcher", brokenModel, policy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.modelPath, tt.policyPath); err == nil {
+				t.Fatal("loaded broken acl files")
+			}
+		})
+	}
+}
+
+func TestReloadReplaysRuntimeRules(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.csv")
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New("../../../test/model.conf", policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Follow(&memLog{}, "node-a", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// a rule granted and one revoked at runtime
+	if _, err := a.AddPolicy(PolicyType, []string{"bob", "topic/*", "produce", "allow"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.RemovePolicy(PolicyType, []string{"consumer", "topic/*", "consume", "allow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file changes the grants of alice's role
+	policy := testPolicy + "p, orders, topic/payments, consume, allow\n"
+	if err := os.WriteFile(policyPath, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject, object, action string
+		allowed                 bool
+	}{
+		{"bob", "topic/orders", "produce", true},
+		{"consumer", "topic/orders", "consume", false},
+		{"alice", "topic/payments", "consume", true},
+	}
+	for _, tt := range tests {
+		err := a.Authorize(tt.subject, tt.object, tt.action)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s %s %s: got %v, want allowed %v", tt.subject, tt.action, tt.object, err, tt.allowed)
+		}
+	}
+
+	if v := a.Version(); v.Number != 2 || v.LastError != "" {
+		t.Fatalf("got version %+v, want 2", v)
+	}
+}
+
+func TestReloadKeepsPolicyOnErrors(t *testing.T) {
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "model.conf")
+	policyPath := filepath.Join(dir, "policy.csv")
+
+	model, err := os.ReadFile("../../../test/model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(modelPath, model, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(modelPath, policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// a matcher casbin would panic on
+	if err := os.WriteFile(modelPath, []byte("[request_definition]\nr = sub, obj, act\n[matchers]\nm = unknown(r.sub)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err == nil {
+		t.Fatal("reloaded a broken model")
+	}
+
+	if err := a.Authorize("consumer", "topic/orders", "consume"); err != nil {
+		t.Fatalf("lost the current policy: %v", err)
+	}
+	if v := a.Version(); v.Number != 1 || v.LastError == "" {
+		t.Fatalf("got version %+v, want 1 with the error", v)
+	}
+}
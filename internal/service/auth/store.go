@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	v1 "logger/gen/go/v1"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+Policy changes made at runtime are stored as records of the
+system topic in the log itself. Every node replicates them
+along with the other records and applies them as they arrive.
+At startup the changes are replayed from the lowest offset of the log.
+
+Nodes don't see the changes in the same order, so each change is
+stamped with a hybrid clock and the name of its node, and only the
+latest change of a rule is in effect: the nodes converge on the same
+policy whatever the order. Before the log is truncated, the changes
+in effect that are stored below the new lowest offset are appended
+again, so they outlive the truncation.
+*/
+
+// SystemTopic is the topic of the records holding the policy changes
+const SystemTopic = "__acl"
+
+// SystemTopicPrefix starts the topics reserved for the cluster
+const SystemTopicPrefix = "__"
+
+// types of policy rules
+const (
+	PolicyType   = "p"
+	GroupingType = "g"
+)
+
+const (
+	opAdd    = "add"
+	opRemove = "remove"
+)
+
+// PolicyChange is a policy rule added or removed at runtime.
+type PolicyChange struct {
+	Op   string   `json:"op"`
+	Type string   `json:"type"`
+	Rule []string `json:"rule"`
+	// Time orders the changes of a rule, in nanoseconds
+	Time int64 `json:"time,omitempty"`
+	// Node made the change, it breaks the ties of Time
+	Node string `json:"node,omitempty"`
+}
+
+// key identifies the rule of the change.
+func (self PolicyChange) key() string {
+	return self.Type + "\x00" + strings.Join(self.Rule, "\x00")
+}
+
+// before reports whether the change was made before the other one.
+// The changes of a tie are applied in the order they are read.
+func (self PolicyChange) before(other PolicyChange) bool {
+	if self.Time != other.Time {
+		return self.Time < other.Time
+	}
+	return self.Node <= other.Node
+}
+
+// policyEntry is the change in effect for a rule
+// and the offset of the record storing it.
+type policyEntry struct {
+	change PolicyChange
+	offset uint64
+}
+
+// PolicyLog stores the policy changes.
+type PolicyLog interface {
+	Append(*v1.Record) (uint64, error)
+	Read(uint64) (*v1.Record, error)
+	LowestOffset() (uint64, error)
+}
+
+// Truncator is implemented by the logs that call
+// a function before removing the records below an offset.
+type Truncator interface {
+	BeforeTruncate(fn func(lowest uint64) error)
+}
+
+// IsSystemTopic reports whether the topic is reserved for the cluster.
+func IsSystemTopic(topic string) bool {
+	return strings.HasPrefix(topic, SystemTopicPrefix)
+}
+
+// Follow replays the policy changes stored in the log and keeps
+// applying the changes appended or replicated to it. The changes
+// made on this node are stamped with its name.
+func (a *Authorizer) Follow(l PolicyLog, node string, interval time.Duration) error {
+	lowest, err := l.LowestOffset()
+	if err != nil {
+		return err
+	}
+
+	a.follow.Lock()
+	a.log = l
+	a.next = lowest
+	a.follow.Unlock()
+
+	a.mu.Lock()
+	a.node = node
+	a.mu.Unlock()
+
+	if err := a.catchUp(); err != nil {
+		return err
+	}
+
+	if t, ok := l.(Truncator); ok {
+		t.BeforeTruncate(a.compact)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.close:
+				return
+			case <-ticker.C:
+				if err := a.catchUp(); err != nil {
+					log.Printf("[ERROR] golog: failed to follow acl changes: %s", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// AddPolicy stores a new rule in the log and applies it.
+func (a *Authorizer) AddPolicy(ptype string, rule []string) (uint64, error) {
+	return a.store(PolicyChange{Op: opAdd, Type: ptype, Rule: rule})
+}
+
+// RemovePolicy stores the removal of a rule in the log and applies it.
+func (a *Authorizer) RemovePolicy(ptype string, rule []string) (uint64, error) {
+	return a.store(PolicyChange{Op: opRemove, Type: ptype, Rule: rule})
+}
+
+// Policies returns the rules in effect by type.
+func (a *Authorizer) Policies() map[string][][]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rules := map[string][][]string{
+		PolicyType:   a.enforcer.GetPolicy(),
+		GroupingType: a.enforcer.GetGroupingPolicy(),
+	}
+	if _, defined := a.enforcer.GetModel()["p"][QuotaType]; defined {
+		rules[QuotaType] = a.enforcer.GetNamedPolicy(QuotaType)
+	}
+
+	return rules
+}
+
+// store appends the change to the log and waits until it is applied.
+func (a *Authorizer) store(change PolicyChange) (uint64, error) {
+	if change.Type != PolicyType && change.Type != GroupingType && change.Type != QuotaType {
+		return 0, status.Errorf(codes.InvalidArgument, "unknown rule type: %q", change.Type)
+	}
+	if len(change.Rule) == 0 {
+		return 0, status.Error(codes.InvalidArgument, "empty rule")
+	}
+
+	a.follow.Lock()
+	l := a.log
+	a.follow.Unlock()
+
+	if l == nil {
+		return 0, status.Error(codes.Unavailable, "acl changes are not stored")
+	}
+
+	a.mu.Lock()
+	change.Time = a.tick()
+	change.Node = a.node
+	a.mu.Unlock()
+
+	off, err := appendChange(l, change)
+	if err != nil {
+		return 0, err
+	}
+
+	return off, a.catchUp()
+}
+
+// tick returns the time of a new change, after the changes seen,
+// the lock must be held.
+func (a *Authorizer) tick() int64 {
+	a.clock = max(a.clock+1, time.Now().UnixNano())
+	return a.clock
+}
+
+// appendChange stores the change in the log.
+func appendChange(l PolicyLog, change PolicyChange) (uint64, error) {
+	b, err := json.Marshal(change)
+	if err != nil {
+		return 0, err
+	}
+
+	return l.Append(&v1.Record{Topic: SystemTopic, Value: b})
+}
+
+// compact appends again the changes in effect stored below
+// the lowest offset, before the log is truncated to it.
+func (a *Authorizer) compact(lowest uint64) error {
+	a.follow.Lock()
+	l := a.log
+	a.follow.Unlock()
+
+	a.mu.RLock()
+	var changes []PolicyChange
+	for _, entry := range a.rules {
+		if entry.offset < lowest {
+			changes = append(changes, entry.change)
+		}
+	}
+	a.mu.RUnlock()
+
+	for _, change := range changes {
+		if _, err := appendChange(l, change); err != nil {
+			return err
+		}
+	}
+
+	// the entries point to the records appended
+	return a.catchUp()
+}
+
+// catchUp applies the changes appended since the last call.
+func (a *Authorizer) catchUp() error {
+	a.follow.Lock()
+	defer a.follow.Unlock()
+
+	for {
+		record, err := a.log.Read(a.next)
+		if status.Code(err) == codes.OutOfRange {
+			// skip the truncated segments
+			lowest, lerr := a.log.LowestOffset()
+			if lerr == nil && lowest > a.next {
+				a.next = lowest
+				continue
+			}
+
+			// the end of the log for now
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		a.next++
+
+		if record.Topic != SystemTopic {
+			continue
+		}
+
+		var change PolicyChange
+		if err := json.Unmarshal(record.Value, &change); err != nil {
+			log.Printf("[ERROR] golog: invalid acl change at offset %d: %s", a.next-1, err)
+			continue
+		}
+
+		a.mu.Lock()
+		err = a.applyLatest(change, a.next-1)
+		a.mu.Unlock()
+
+		if err != nil {
+			log.Printf("[ERROR] golog: failed to apply acl change at offset %d: %s", a.next-1, err)
+		}
+	}
+}
+
+// applyLatest applies the change unless a later one of the rule
+// is in effect, the lock must be held.
+func (a *Authorizer) applyLatest(change PolicyChange, offset uint64) error {
+	key := change.key()
+	if entry, ok := a.rules[key]; ok && !entry.change.before(change) {
+		return nil
+	}
+
+	err := apply(a.enforcer, change)
+	if err != nil {
+		return err
+	}
+
+	a.rules[key] = policyEntry{change: change, offset: offset}
+	a.clock = max(a.clock, change.Time)
+
+	return nil
+}
+
+// apply adds or removes the rule of a change.
+func apply(enforcer *casbin.Enforcer, change PolicyChange) error {
+	var err error
+	switch {
+	case change.Op == opAdd && change.Type == PolicyType:
+		_, err = enforcer.AddPolicySafe(change.Rule)
+	case change.Op == opAdd && change.Type == GroupingType:
+		_, err = enforcer.AddGroupingPolicySafe(change.Rule)
+	case change.Op == opRemove && change.Type == PolicyType:
+		_, err = enforcer.RemovePolicySafe(change.Rule)
+	case change.Op == opRemove && change.Type == GroupingType:
+		_, err = enforcer.RemoveGroupingPolicySafe(change.Rule)
+	case change.Op == opAdd && change.Type == QuotaType:
+		if _, _, err = parseQuota(change.Rule); err == nil {
+			_, err = enforcer.AddNamedPolicySafe(QuotaType, change.Rule)
+		}
+	case change.Op == opRemove && change.Type == QuotaType:
+		_, err = removeNamedPolicy(enforcer, QuotaType, change.Rule)
+	default:
+		err = fmt.Errorf("unknown change %q of %q rule", change.Op, change.Type)
+	}
+
+	return err
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// memLog is a log kept in memory, truncated like the segments are.
+type memLog struct {
+	mu      sync.Mutex
+	lowest  uint64
+	records []*v1.Record
+	hooks   []func(uint64) error
+}
+
+func (self *memLog) Append(record *v1.Record) (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	record = proto.Clone(record).(*v1.Record)
+	record.Offset = self.lowest + uint64(len(self.records))
+	self.records = append(self.records, record)
+
+	return record.Offset, nil
+}
+
+func (self *memLog) Read(offset uint64) (*v1.Record, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if offset < self.lowest || offset >= self.lowest+uint64(len(self.records)) {
+		return nil, status.Errorf(codes.OutOfRange, "offset out of range: %d", offset)
+	}
+
+	return self.records[offset-self.lowest], nil
+}
+
+func (self *memLog) LowestOffset() (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.lowest, nil
+}
+
+func (self *memLog) BeforeTruncate(fn func(uint64) error) {
+	self.hooks = append(self.hooks, fn)
+}
+
+// Truncate removes the records below lowest, the last one is kept.
+func (self *memLog) Truncate(lowest uint64) error {
+	for _, fn := range self.hooks {
+		if err := fn(lowest); err != nil {
+			return err
+		}
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	last := self.lowest + uint64(len(self.records)) - 1
+	lowest = min(lowest, last)
+	self.records = self.records[lowest-self.lowest:]
+	self.lowest = lowest
+
+	return nil
+}
+
+// replicate copies the records of the system topic from one log to another.
+func (self *memLog) replicate(to *memLog) {
+	self.mu.Lock()
+	records := append([]*v1.Record{}, self.records...)
+	self.mu.Unlock()
+
+	for _, record := range records {
+		if record.Topic == SystemTopic {
+			to.Append(record)
+		}
+	}
+}
+
+func newAuthorizer(t *testing.T, node string, l PolicyLog) *Authorizer {
+	t.Helper()
+
+	policyPath := filepath.Join(t.TempDir(), "policy.csv")
+	if err := os.WriteFile(policyPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New("../../../test/model.conf", policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Follow(l, node, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	return a
+}
+
+func TestPolicyChangesConverge(t *testing.T) {
+	logA, logB := &memLog{}, &memLog{}
+	a := newAuthorizer(t, "node-a", logA)
+	b := newAuthorizer(t, "node-b", logB)
+
+	rule := []string{"alice", "topic/orders", "consume", "allow"}
+
+	// node-a grants, then node-b revokes after seeing nothing of it
+	if _, err := a.AddPolicy(PolicyType, rule); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.RemovePolicy(PolicyType, rule); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddPolicy(PolicyType, []string{"bob", "topic/*", "consume", "allow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each node receives the changes of the other in another order
+	logA.replicate(logB)
+	logB.replicate(logA)
+	for _, authorizer := range []*Authorizer{a, b} {
+		if err := authorizer.catchUp(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, authorizer := range map[string]*Authorizer{"node-a": a, "node-b": b} {
+		if err := authorizer.Authorize("alice", "topic/orders", "consume"); err == nil {
+			t.Fatalf("%s kept the revoked rule", name)
+		}
+		if err := authorizer.Authorize("bob", "topic/orders", "consume"); err != nil {
+			t.Fatalf("%s misses a rule: %s", name, err)
+		}
+	}
+}
+
+func TestPolicyChangesOutliveTruncation(t *testing.T) {
+	l := &memLog{}
+	a := newAuthorizer(t, "node-a", l)
+
+	rule := []string{"alice", "topic/orders", "consume", "allow"}
+	if _, err := a.AddPolicy(PolicyType, rule); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		l.Append(&v1.Record{Topic: "orders", Value: []byte("order")})
+	}
+
+	if err := l.Truncate(11); err != nil {
+		t.Fatal(err)
+	}
+
+	// a node replaying the truncated log gets the rule
+	replayed := newAuthorizer(t, "node-b", l)
+	if err := replayed.Authorize("alice", "topic/orders", "consume"); err != nil {
+		t.Fatalf("rule lost with the truncated records: %s", err)
+	}
+
+	// truncating again copies the records once more, not every change
+	if err := l.Truncate(13); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.catchUp(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(a.rules); n != 1 {
+		t.Fatalf("got %d rules in effect, want 1", n)
+	}
+}
@@ -0,0 +1,83 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+/*
+API keys are sent in the x-api-key header. Only their SHA-256 hashes
+are stored, in a JSON object of hex encoded hashes and subjects:
+{"9f86d081884c7d65...": "ci-job"}
+*/
+
+const apiKeyHeader = "x-api-key"
+
+// APIKeys authenticates the api keys of the store.
+type APIKeys struct {
+	// hashes maps the key hashes to their subjects
+	hashes map[[sha256.Size]byte]string
+}
+
+var _ Authenticator = (*APIKeys)(nil)
+
+// LoadAPIKeys reads the hashed api keys.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored map[string]string
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse api keys %q: %w", path, err)
+	}
+
+	keys := &APIKeys{hashes: make(map[[sha256.Size]byte]string, len(stored))}
+	for h, subject := range stored {
+		var hash [sha256.Size]byte
+		n, err := hex.Decode(hash[:], []byte(h))
+		if err != nil || n != sha256.Size {
+			return nil, fmt.Errorf("invalid api key hash for %q", subject)
+		}
+		keys.hashes[hash] = subject
+	}
+
+	return keys, nil
+}
+
+func (self *APIKeys) Authenticate(ctx context.Context) (string, error) {
+	key, ok := fromMetadata(ctx, apiKeyHeader, "")
+	if !ok {
+		return "", ErrNoCredentials
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	for h, subject := range self.hashes {
+		if subtle.ConstantTimeCompare(h[:], hash[:]) == 1 {
+			return subject, nil
+		}
+	}
+
+	return "", errInvalid("api key", "unknown key")
+}
+
+// GenerateAPIKey returns a new api key and the hash to store.
+func GenerateAPIKey() (key string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	key = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(key))
+
+	return key, hex.EncodeToString(sum[:]), nil
+}
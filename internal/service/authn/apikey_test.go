@@ -0,0 +1,120 @@
+package authn_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"logger/internal/service/authn"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKeys(t *testing.T) {
+	key, hash, err := authn.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := authn.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	b, _ := json.Marshal(map[string]string{hash: "ci-job"})
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := authn.LoadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		subject string
+		code    codes.Code
+		err     error
+	}{
+		{name: "stored key", ctx: incoming("x-api-key", key), subject: "ci-job"},
+		{name: "unknown key", ctx: incoming("x-api-key", other), code: codes.Unauthenticated},
+		// the hash itself isn't a key
+		{name: "hash", ctx: incoming("x-api-key", hash), code: codes.Unauthenticated},
+		{name: "no header", ctx: context.Background(), code: codes.Unknown, err: authn.ErrNoCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := keys.Authenticate(tt.ctx)
+			if subject != tt.subject || status.Code(err) != tt.code || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Fatalf("got %q, %v, want %q, %v", subject, err, tt.subject, tt.code)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeysRejectsBadHashes(t *testing.T) {
+	for _, stored := range []string{`{"abc": "short"}`, `{"zz": "not hex"}`, `[]`} {
+		path := filepath.Join(t.TempDir(), "apikeys.json")
+		if err := os.WriteFile(path, []byte(stored), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := authn.LoadAPIKeys(path); err == nil {
+			t.Errorf("loaded %s", stored)
+		}
+	}
+}
+
+func TestAuthenticateTriesInOrder(t *testing.T) {
+	key, hash, err := authn.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	b, _ := json.Marshal(map[string]string{hash: "ci-job"})
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticators, err := authn.New(authn.Config{
+		KeySetFile:  writeKeySet(t),
+		APIKeysFile: path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the token has no credentials, the api key decides
+	subject, err := authn.Authenticate(incoming("x-api-key", key), authenticators)
+	if err != nil || subject != "ci-job" {
+		t.Fatalf("got %q, %v, want ci-job", subject, err)
+	}
+
+	// an invalid token isn't skipped
+	_, err = authn.Authenticate(incoming("authorization", "Bearer x.y.z", "x-api-key", key), authenticators)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+
+	_, err = authn.Authenticate(context.Background(), authenticators)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+}
+
+func writeKeySet(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"k1": "c2VjcmV0"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,33 @@
+package authn
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// PerRPCCredentials attaches a bearer token or an api key
+// to every call of a client.
+type PerRPCCredentials struct {
+	Token  string
+	APIKey string
+}
+
+var _ credentials.PerRPCCredentials = PerRPCCredentials{}
+
+func (self PerRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := make(map[string]string)
+	if self.Token != "" {
+		md[authorizationHeader] = bearerScheme + " " + self.Token
+	}
+	if self.APIKey != "" {
+		md[apiKeyHeader] = self.APIKey
+	}
+
+	return md, nil
+}
+
+// RequireTransportSecurity keeps the credentials off plaintext connections.
+func (self PerRPCCredentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,123 @@
+package authn
+
+import (
+	"crypto/x509"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+The identity of a client certificate is rendered from formats with
+the placeholders {cn}, {uri} and {dns}: the common name, the first
+URI SAN, e.g. spiffe://team/service, and the first DNS SAN.
+The formats are tried in order and the first one whose placeholders
+are all present in the certificate is used. The rules then rewrite
+the identity, the first rule that matches is applied:
+{Match: "^spiffe://([^/]+)/(.+)$", Replace: "$1/$2"}
+*/
+
+// default identity of the certificates, the common name
+var defaultFormats = []string{"{cn}"}
+
+var placeholder = regexp.MustCompile(`\{(cn|uri|dns)\}`)
+
+// Rule rewrites the identities that match the regular expression.
+type Rule struct {
+	Match   string
+	Replace string
+}
+
+// IdentityConfig is used to configure the IdentityMapper.
+type IdentityConfig struct {
+	Formats []string
+	Rules   []Rule
+}
+
+// IdentityMapper maps a client certificate to a subject.
+type IdentityMapper struct {
+	formats []string
+	rules   []rule
+}
+
+type rule struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+// NewIdentityMapper checks the formats and compiles the rules.
+func NewIdentityMapper(config IdentityConfig) (*IdentityMapper, error) {
+	m := &IdentityMapper{formats: config.Formats}
+	if len(m.formats) == 0 {
+		m.formats = defaultFormats
+	}
+
+	for _, f := range m.formats {
+		if !placeholder.MatchString(f) {
+			return nil, fmt.Errorf("identity format %q has no placeholder", f)
+		}
+	}
+
+	for _, r := range config.Rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity rule %q: %w", r.Match, err)
+		}
+		m.rules = append(m.rules, rule{match: re, replace: r.Replace})
+	}
+
+	return m, nil
+}
+
+// Identity returns the subject of the certificate.
+func (self *IdentityMapper) Identity(cert *x509.Certificate) (string, error) {
+	values := map[string]string{
+		"{cn}": cert.Subject.CommonName,
+	}
+	if len(cert.URIs) > 0 {
+		values["{uri}"] = cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		values["{dns}"] = cert.DNSNames[0]
+	}
+
+	for _, f := range self.formats {
+		id, ok := render(f, values)
+		if !ok {
+			continue
+		}
+
+		for _, r := range self.rules {
+			if r.match.MatchString(id) {
+				id = r.match.ReplaceAllString(id, r.replace)
+				break
+			}
+		}
+
+		if id == "" {
+			return "", errInvalid("certificate", "identity rewritten to nothing")
+		}
+
+		return id, nil
+	}
+
+	return "", errInvalid(
+		"certificate",
+		"no identity matches "+strings.Join(self.formats, ", "),
+	)
+}
+
+// render replaces the placeholders of the format,
+// it fails when a placeholder has no value.
+func render(format string, values map[string]string) (string, bool) {
+	ok := true
+	id := placeholder.ReplaceAllStringFunc(format, func(p string) string {
+		v := values[p]
+		if v == "" {
+			ok = false
+		}
+		return v
+	})
+
+	return id, ok
+}
@@ -0,0 +1,140 @@
+package authn_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"logger/internal/service/authn"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://team/billing")
+	full := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "alice"},
+		URIs:     []*url.URL{spiffe},
+		DNSNames: []string{"billing.team.svc"},
+	}
+	cnOnly := &x509.Certificate{Subject: pkix.Name{CommonName: "bob"}}
+
+	tests := []struct {
+		name   string
+		config authn.IdentityConfig
+		cert   *x509.Certificate
+		want   string
+		code   codes.Code
+	}{
+		{
+			name: "common name by default",
+			cert: full,
+			want: "alice",
+		},
+		{
+			name:   "uri",
+			config: authn.IdentityConfig{Formats: []string{"{uri}"}},
+			cert:   full,
+			want:   "spiffe://team/billing",
+		},
+		{
+			name:   "combined placeholders",
+			config: authn.IdentityConfig{Formats: []string{"{dns}/{cn}"}},
+			cert:   full,
+			want:   "billing.team.svc/alice",
+		},
+		{
+			name:   "first format with every placeholder",
+			config: authn.IdentityConfig{Formats: []string{"{uri}", "{cn}"}},
+			cert:   cnOnly,
+			want:   "bob",
+		},
+		{
+			name: "first matching rule",
+			config: authn.IdentityConfig{
+				Formats: []string{"{uri}"},
+				Rules: []authn.Rule{
+					{Match: "^spiffe://other/(.+)$", Replace: "other-$1"},
+					{Match: "^spiffe://([^/]+)/(.+)$", Replace: "$1/$2"},
+					{Match: "^spiffe://.*$", Replace: "unreachable"},
+				},
+			},
+			cert: full,
+			want: "team/billing",
+		},
+		{
+			name: "no matching rule",
+			config: authn.IdentityConfig{
+				Rules: []authn.Rule{{Match: "^spiffe://(.+)$", Replace: "$1"}},
+			},
+			cert: full,
+			want: "alice",
+		},
+		{
+			name:   "missing placeholders",
+			config: authn.IdentityConfig{Formats: []string{"{uri}", "{dns}"}},
+			cert:   cnOnly,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name: "rewritten to nothing",
+			config: authn.IdentityConfig{
+				Rules: []authn.Rule{{Match: "^.*$", Replace: ""}},
+			},
+			cert: full,
+			code: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := authn.NewIdentityMapper(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := m.Identity(tt.cert)
+			if status.Code(err) != tt.code || got != tt.want {
+				t.Fatalf("got %q, %v, want %q, %v", got, err, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestNewIdentityMapperRejectsBadConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config authn.IdentityConfig
+	}{
+		{"format without placeholder", authn.IdentityConfig{Formats: []string{"cn"}}},
+		{"invalid rule", authn.IdentityConfig{Rules: []authn.Rule{{Match: "(", Replace: ""}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := authn.NewIdentityMapper(tt.config); err == nil {
+				t.Fatal("accepted the config")
+			}
+		})
+	}
+}
+
+func TestMTLSMapsIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://team/billing")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, URIs: []*url.URL{spiffe}}
+
+	m, err := authn.NewIdentityMapper(authn.IdentityConfig{
+		Formats: []string{"{uri}"},
+		Rules:   []authn.Rule{{Match: "^spiffe://([^/]+)/(.+)$", Replace: "$1/$2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := authn.MTLS{Identity: m}.Authenticate(peerContext(cert))
+	if err != nil || subject != "team/billing" {
+		t.Fatalf("got %q, %v, want team/billing", subject, err)
+	}
+}
@@ -0,0 +1,128 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+/*
+This package authenticates the callers of the servers.
+Every Authenticator checks one kind of credentials and returns
+the subject passed to the Authorizer, so a client authorized as
+"root" is the same subject whatever credentials it presented.
+The authenticators are tried in order, the first one that finds
+its credentials in the request decides.
+*/
+
+// ErrNoCredentials is returned by an Authenticator when the request
+// doesn't carry its kind of credentials, the next one is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator returns the subject of a request.
+type Authenticator interface {
+	Authenticate(ctx context.Context) (string, error)
+}
+
+// Config chooses the enabled authenticators.
+type Config struct {
+	// MTLS takes the subject from the verified client certificate
+	MTLS bool
+	// Revocations are checked on every call authenticated with mTLS
+	Revocations RevocationChecker
+	// Identity maps the certificates to subjects
+	Identity IdentityConfig
+	// KeySetFile enables bearer tokens signed with one of its keys
+	KeySetFile string
+	// APIKeysFile enables the api keys it stores hashed
+	APIKeysFile string
+}
+
+// New returns the authenticators enabled by the config,
+// in the order they are tried.
+func New(config Config) ([]Authenticator, error) {
+	var authenticators []Authenticator
+
+	if config.MTLS {
+		identity, err := NewIdentityMapper(config.Identity)
+		if err != nil {
+			return nil, err
+		}
+
+		authenticators = append(authenticators, MTLS{
+			Identity:    identity,
+			Revocations: config.Revocations,
+		})
+	}
+
+	if config.KeySetFile != "" {
+		keys, err := LoadKeySet(config.KeySetFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, &Token{Keys: keys})
+	}
+
+	if config.APIKeysFile != "" {
+		keys, err := LoadAPIKeys(config.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, keys)
+	}
+
+	if len(authenticators) == 0 {
+		return nil, errors.New("no authenticator is enabled")
+	}
+
+	return authenticators, nil
+}
+
+// Authenticate returns the subject of the first authenticator
+// that finds its credentials in the request.
+func Authenticate(ctx context.Context, authenticators []Authenticator) (string, error) {
+	for _, a := range authenticators {
+		subject, err := a.Authenticate(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return subject, nil
+	}
+
+	return "", status.Error(codes.Unauthenticated, "missing credentials")
+}
+
+// errInvalid is returned for credentials that fail to verify.
+func errInvalid(kind, reason string) error {
+	return status.Errorf(codes.Unauthenticated, "invalid %s: %s", kind, reason)
+}
+
+// fromMetadata returns the value of the authorization header
+// with the scheme, e.g. "Bearer".
+func fromMetadata(ctx context.Context, header, scheme string) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	for _, v := range md.Get(header) {
+		if scheme == "" {
+			return v, true
+		}
+
+		prefix := scheme + " "
+		if len(v) > len(prefix) && strings.EqualFold(v[:len(prefix)], prefix) {
+			return v[len(prefix):], true
+		}
+	}
+
+	return "", false
+}
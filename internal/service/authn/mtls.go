@@ -0,0 +1,53 @@
+package authn
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// MTLS authenticates the verified TLS client certificate,
+// the subject is the common name of the certificate
+// unless an identity mapper is set.
+type MTLS struct {
+	Identity *IdentityMapper
+	// Revocations rejects the revoked certificates on every call,
+	// the connections established before included. The handshakes
+	// don't check them, so the clients get an Unauthenticated status
+	// rather than a connection error.
+	Revocations RevocationChecker
+}
+
+// RevocationChecker returns an error for a revoked certificate.
+type RevocationChecker interface {
+	Check(cert *x509.Certificate) error
+}
+
+var _ Authenticator = MTLS{}
+
+func (self MTLS) Authenticate(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return "", ErrNoCredentials
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return "", ErrNoCredentials
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	if self.Revocations != nil {
+		if err := self.Revocations.Check(cert); err != nil {
+			return "", err
+		}
+	}
+
+	if self.Identity != nil {
+		return self.Identity.Identity(cert)
+	}
+
+	return cert.Subject.CommonName, nil
+}
@@ -0,0 +1,56 @@
+package authn_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"logger/internal/service/authn"
+	"logger/internal/service/revocation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// peerContext returns the context of a call made with the certificate.
+func peerContext(cert *x509.Certificate) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+}
+
+func TestMTLSRejectsRevokedCertificates(t *testing.T) {
+	revocations, err := revocation.New("", filepath.Join(t.TempDir(), "revoked.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mtls := authn.MTLS{Revocations: revocations}
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(0x2a),
+		Subject:      pkix.Name{CommonName: "alice"},
+	}
+
+	subject, err := mtls.Authenticate(peerContext(cert))
+	if err != nil || subject != "alice" {
+		t.Fatalf("got %q, %v, want alice", subject, err)
+	}
+
+	if err := revocations.Revoke("2a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the call is refused, not the connection
+	_, err = mtls.Authenticate(peerContext(cert))
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+}
@@ -0,0 +1,176 @@
+package authn
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+Bearer tokens are JWTs signed with HMAC-SHA256 (HS256).
+The kid header names the key of the key set that signed the token,
+the sub claim is the subject and exp, when set, its expiry.
+The key set is a JSON object of key ids and base64 encoded secrets:
+{"2024-06": "c2VjcmV0..."}
+*/
+
+const (
+	authorizationHeader = "authorization"
+	bearerScheme        = "Bearer"
+	tokenAlgorithm      = "HS256"
+)
+
+// Token authenticates the bearer tokens signed with the key set.
+type Token struct {
+	Keys map[string][]byte
+	// Issuer and Audience are checked when set
+	Issuer   string
+	Audience string
+}
+
+var _ Authenticator = (*Token)(nil)
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid"`
+}
+
+// Claims are the claims of a token.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// LoadKeySet reads the signing keys of the tokens.
+func LoadKeySet(path string) (map[string][]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded map[string]string
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return nil, fmt.Errorf("failed to parse key set %q: %w", path, err)
+	}
+
+	keys := make(map[string][]byte, len(encoded))
+	for kid, v := range encoded {
+		keys[kid], err = base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %q: %w", kid, err)
+		}
+	}
+
+	return keys, nil
+}
+
+func (self *Token) Authenticate(ctx context.Context) (string, error) {
+	token, ok := fromMetadata(ctx, authorizationHeader, bearerScheme)
+	if !ok {
+		return "", ErrNoCredentials
+	}
+
+	claims, err := self.Verify(token, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return claims.Subject, nil
+}
+
+// Verify checks the signature and the claims of the token.
+func (self *Token) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalid("token", "malformed")
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errInvalid("token", "malformed header")
+	}
+	if header.Alg != tokenAlgorithm {
+		return nil, errInvalid("token", "unsupported algorithm "+header.Alg)
+	}
+
+	key, ok := self.Keys[header.Kid]
+	if !ok {
+		return nil, errInvalid("token", "unknown key "+header.Kid)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, sign(key, parts[0]+"."+parts[1])) {
+		return nil, errInvalid("token", "bad signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errInvalid("token", "malformed claims")
+	}
+
+	switch {
+	case claims.Subject == "":
+		return nil, errInvalid("token", "missing subject")
+	case claims.ExpiresAt != 0 && !now.Before(time.Unix(claims.ExpiresAt, 0)):
+		return nil, errInvalid("token", "expired")
+	case claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0)):
+		return nil, errInvalid("token", "not valid yet")
+	case self.Issuer != "" && claims.Issuer != self.Issuer:
+		return nil, errInvalid("token", "wrong issuer")
+	case self.Audience != "" && claims.Audience != self.Audience:
+		return nil, errInvalid("token", "wrong audience")
+	}
+
+	return &claims, nil
+}
+
+// Sign returns a token with the claims signed with the key.
+func Sign(kid string, key []byte, claims Claims) (string, error) {
+	header, err := encodeSegment(tokenHeader{Alg: tokenAlgorithm, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := header + "." + payload
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(key, signed)), nil
+}
+
+func sign(key []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func encodeSegment(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,199 @@
+package authn_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"logger/internal/service/authn"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// incoming returns the context of a call with the metadata.
+func incoming(kv ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...))
+}
+
+func signed(t *testing.T, kid string, key []byte, claims authn.Claims) string {
+	t.Helper()
+
+	token, err := authn.Sign(kid, key, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// withHeader replaces the header of the token, keeping its signature.
+func withHeader(token string, header string) string {
+	parts := strings.Split(token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(header))
+	return strings.Join(parts, ".")
+}
+
+func TestTokenVerify(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1_700_000_000, 0)
+	verifier := &authn.Token{
+		Keys:     map[string][]byte{"k1": key},
+		Issuer:   "golog",
+		Audience: "cluster",
+	}
+	valid := authn.Claims{Subject: "alice", Issuer: "golog", Audience: "cluster"}
+
+	with := func(change func(c *authn.Claims)) authn.Claims {
+		c := valid
+		change(&c)
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{
+			name:  "valid",
+			token: signed(t, "k1", key, valid),
+		},
+		{
+			name:  "not expired",
+			token: signed(t, "k1", key, with(func(c *authn.Claims) { c.ExpiresAt = now.Add(time.Second).Unix() })),
+		},
+		{
+			name:  "expired",
+			token: signed(t, "k1", key, with(func(c *authn.Claims) { c.ExpiresAt = now.Unix() })),
+			want:  "expired",
+		},
+		{
+			name:  "not valid yet",
+			token: signed(t, "k1", key, with(func(c *authn.Claims) { c.NotBefore = now.Add(time.Minute).Unix() })),
+			want:  "not valid yet",
+		},
+		{
+			name:  "bad signature",
+			token: signed(t, "k1", []byte("other secret"), valid),
+			want:  "bad signature",
+		},
+		{
+			name:  "unknown key",
+			token: signed(t, "k2", key, valid),
+			want:  "unknown key k2",
+		},
+		{
+			name:  "unsigned",
+			token: withHeader(signed(t, "k1", key, valid), `{"alg":"none","kid":"k1"}`),
+			want:  "unsupported algorithm none",
+		},
+		{
+			name:  "other algorithm",
+			token: withHeader(signed(t, "k1", key, valid), `{"alg":"HS512","kid":"k1"}`),
+			want:  "unsupported algorithm HS512",
+		},
+		{
+			name:  "header changed after signing",
+			token: withHeader(signed(t, "k1", key, valid), `{"alg":"HS256","kid":"k1","typ":"x"}`),
+			want:  "bad signature",
+		},
+		{
+			name:  "missing subject",
+			token: signed(t, "k1", key, with(func(c *authn.Claims) { c.Subject = "" })),
+			want:  "missing subject",
+		},
+		{
+			name:  "wrong issuer",
+			token: signed(t, "k1", key, with(func(c *authn.Claims) { c.Issuer = "other" })),
+			want:  "wrong issuer",
+		},
+		{
+			name:  "wrong audience",
+			token: signed(t, "k1", key, with(func(c *authn.Claims) { c.Audience = "other" })),
+			want:  "wrong audience",
+		},
+		{
+			name:  "malformed",
+			token: "not.a-token",
+			want:  "malformed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token, now)
+			if tt.want == "" {
+				if err != nil || claims.Subject != "alice" {
+					t.Fatalf("got %+v, %v, want alice", claims, err)
+				}
+				return
+			}
+
+			if status.Code(err) != codes.Unauthenticated || !strings.HasSuffix(status.Convert(err).Message(), tt.want) {
+				t.Fatalf("got %v, want Unauthenticated: %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenAuthenticate(t *testing.T) {
+	key := []byte("secret")
+	token := &authn.Token{Keys: map[string][]byte{"k1": key}}
+	bearer := signed(t, "k1", key, authn.Claims{Subject: "alice"})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		subject string
+		err     error
+	}{
+		{"bearer token", incoming("authorization", "Bearer "+bearer), "alice", nil},
+		{"any case of the scheme", incoming("authorization", "bearer "+bearer), "alice", nil},
+		{"no header", context.Background(), "", authn.ErrNoCredentials},
+		{"other scheme", incoming("authorization", "Basic YWxpY2U="), "", authn.ErrNoCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := token.Authenticate(tt.ctx)
+			if subject != tt.subject || !errors.Is(err, tt.err) {
+				t.Fatalf("got %q, %v, want %q, %v", subject, err, tt.subject, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	write := func(v any) string {
+		t.Helper()
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "keys.json")
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	keys, err := authn.LoadKeySet(write(map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("secret"))}))
+	if err != nil || string(keys["k1"]) != "secret" {
+		t.Fatalf("got %q, %v, want the secret of k1", keys, err)
+	}
+
+	if _, err := authn.LoadKeySet(write(map[string]string{"k1": "not base64!"})); err == nil {
+		t.Fatal("loaded a key that isn't base64")
+	}
+	if _, err := authn.LoadKeySet(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("loaded a missing key set")
+	}
+}
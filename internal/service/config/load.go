@@ -0,0 +1,296 @@
+package config
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// envPrefix starts the environment variables of the settings
+	envPrefix = "GOLOG_"
+	// ConfigEnv is the path of the config file when -config is not set
+	ConfigEnv = "GOLOG_CONFIG"
+)
+
+// LoadServer loads the configuration of a node from the defaults,
+// the file of the -config flag or GOLOG_CONFIG, the environment
+// and the flags, in that order, and validates it.
+func LoadServer(name string, args []string) (*Server, error) {
+	settings := keys(DefaultServer())
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(ConfigEnv), "YAML or TOML config file")
+
+	// the flags are applied after the file and the environment
+	flags := make(map[string]string)
+	for _, key := range sortedKeys(settings) {
+		key := key
+		fs.Func(key, "sets "+key, func(v string) error {
+			flags[key] = v
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c, errs, err := load(*path, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err.(ValidationError)...)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	c.name, c.args = name, args
+
+	return c, nil
+}
+
+// LoadFiles resolves the files of a node from the defaults, the file
+// of GOLOG_CONFIG and the environment, as LoadServer does, for the
+// commands that use the certificates next to the node. The other
+// settings aren't validated, the files may not exist yet.
+func LoadFiles() (*Server, error) {
+	c, errs, err := load(os.Getenv(ConfigEnv), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return c, nil
+}
+
+// load applies the file, the environment and the flags to the defaults.
+func load(path string, flags map[string]string) (*Server, ValidationError, error) {
+	c := DefaultServer()
+	settings := keys(c)
+
+	var errs ValidationError
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for key, v := range values {
+			field, ok := settings[key]
+			if !ok {
+				errs = append(errs, FieldError{Field: key, Message: "unknown setting"})
+				continue
+			}
+			if err := set(field, v); err != nil {
+				errs = append(errs, FieldError{Field: key, Message: err.Error()})
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(settings) {
+		if v, ok := os.LookupEnv(EnvName(key)); ok {
+			if err := set(settings[key], v); err != nil {
+				errs = append(errs, FieldError{Field: key, Message: err.Error()})
+			}
+		}
+	}
+
+	for key, v := range flags {
+		if err := set(settings[key], v); err != nil {
+			errs = append(errs, FieldError{Field: key, Message: err.Error()})
+		}
+	}
+
+	// the files default to the data dir of the last layer
+	c.defaultFiles()
+
+	return c, errs, nil
+}
+
+// Reload loads the configuration again from the same
+// file, environment and flags.
+func (self *Server) Reload() (*Server, error) {
+	return LoadServer(self.name, self.args)
+}
+
+// Diff returns the keys of the settings that differ.
+func Diff(a, b *Server) []string {
+	before, after := keys(a), keys(b)
+
+	var changed []string
+	for _, key := range sortedKeys(before) {
+		if !reflect.DeepEqual(before[key].Interface(), after[key].Interface()) {
+			changed = append(changed, key)
+		}
+	}
+
+	return changed
+}
+
+// EnvName returns the environment variable of a setting.
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// readFile reads the settings of a YAML or TOML file by key.
+func readFile(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &tree)
+	case ".toml":
+		var t *toml.Tree
+		t, err = toml.LoadBytes(b)
+		if err == nil {
+			tree = t.ToMap()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file %q, use .yaml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+
+	values := make(map[string]any)
+	flatten("", tree, values)
+
+	return values, nil
+}
+
+// flatten stores the leaves of the tree by their dotted key.
+func flatten(prefix string, tree map[string]any, values map[string]any) {
+	for k, v := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		if sub, ok := v.(map[string]any); ok {
+			flatten(key, sub, values)
+			continue
+		}
+
+		values[key] = v
+	}
+}
+
+// keys returns the fields of the config by key.
+func keys(c *Server) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	walk("", reflect.ValueOf(c).Elem(), fields)
+
+	return fields
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func walk(prefix string, v reflect.Value, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct && !f.Addr().Type().Implements(textUnmarshaler) {
+			walk(key, f, fields)
+			continue
+		}
+
+		fields[key] = f
+	}
+}
+
+// set converts the value of a file, a variable or a flag to the field.
+func set(field reflect.Value, value any) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(fmt.Sprint(value)))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %v", value)
+		}
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(fmt.Sprint(value))
+		if err != nil {
+			return fmt.Errorf("expected a boolean, got %v", value)
+		}
+		field.SetBool(b)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(fmt.Sprint(value), 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected a positive integer, got %v", value)
+		}
+		field.SetUint(n)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(fmt.Sprint(value), 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %v", value)
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		var list []string
+		switch v := value.(type) {
+		case string:
+			// variables and flags are comma separated
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+		case []any:
+			for _, s := range v {
+				list = append(list, fmt.Sprint(s))
+			}
+		default:
+			return fmt.Errorf("expected a list, got %v", value)
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting of type %s", field.Type())
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string]reflect.Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dataDir creates a data dir with the files a node needs.
+func dataDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, f := range []string{
+		"tls/server.pem", "tls/server-key.pem", "tls/ca.pem",
+		"tls/peer.pem", "tls/peer-key.pem",
+		"acl/model.conf", "acl/policy.csv",
+	} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fields returns the fields of the errors of a ValidationError.
+func fields(t *testing.T, err error) []string {
+	t.Helper()
+
+	var errs ValidationError
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Field)
+	}
+	return got
+}
+
+func TestLoadServerPrecedence(t *testing.T) {
+	dir := dataDir(t)
+	path := writeConfig(t, "node.yaml", `
+node_name: from-file
+log_level: warn
+data_dir: `+dir+`
+segment:
+  max_store_bytes: 2048
+discovery:
+  start_join_addrs: [127.0.0.1:9401]
+`)
+
+	t.Setenv(ConfigEnv, path)
+	t.Setenv("GOLOG_NODE_NAME", "from-env")
+	t.Setenv("GOLOG_LOG_LEVEL", "error")
+	t.Setenv("GOLOG_DISCOVERY_START_JOIN_ADDRS", "127.0.0.1:9402, 127.0.0.1:9403")
+
+	c, err := LoadServer("serve", []string{"-node_name", "from-flag", "-verify.interval", "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		got  any
+		want any
+	}{
+		{"the flags override the environment", c.NodeName, "from-flag"},
+		{"the environment overrides the file", c.LogLevel, "error"},
+		{"the lists of the environment are comma separated", strings.Join(c.Discovery.StartJoinAddrs, " "), "127.0.0.1:9402 127.0.0.1:9403"},
+		{"the file overrides the defaults", c.Segment.MaxStoreBytes, uint64(2048)},
+		{"the defaults are kept", c.Segment.MaxIndexBytes, uint64(1024)},
+		{"durations are parsed", time.Duration(c.Verify.Interval), time.Minute},
+		{"the files default to the data dir", c.TLS.CAFile, filepath.Join(dir, "tls", "ca.pem")},
+		{"the acl files default to the data dir", c.ACL.PolicyFile, filepath.Join(dir, "acl", "policy.csv")},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.key, tt.got, tt.want)
+		}
+	}
+
+	// the config flag overrides GOLOG_CONFIG
+	other := writeConfig(t, "other.toml", "node_name = \"from-toml\"\ndata_dir = \""+dir+"\"\n")
+	t.Setenv("GOLOG_NODE_NAME", "")
+	os.Unsetenv("GOLOG_NODE_NAME")
+
+	c, err = LoadServer("serve", []string{"-config", other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.NodeName != "from-toml" || c.LogLevel != "error" {
+		t.Fatalf("got %q at %q, want from-toml at error", c.NodeName, c.LogLevel)
+	}
+
+	// a reload reads the layers again
+	t.Setenv("GOLOG_LOG_LEVEL", "debug")
+	reloaded, err := c.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := Diff(c, reloaded); strings.Join(diff, " ") != "log_level" {
+		t.Fatalf("got changes %v, want log_level", diff)
+	}
+}
+
+func TestLoadServerRejectsBadSettings(t *testing.T) {
+	dir := dataDir(t)
+	path := writeConfig(t, "node.yaml", `
+data_dir: `+dir+`
+segment:
+  max_store_bytes: many
+unknown: true
+`)
+	t.Setenv("GOLOG_AUTHN_MTLS", "maybe")
+
+	_, err := LoadServer("serve", []string{"-config", path, "-rpc.bind_addr", "8400"})
+
+	want := []string{"unknown", "segment.max_store_bytes", "authn.mtls", "rpc.bind_addr"}
+	got := fields(t, err)
+	for _, field := range want {
+		if !strings.Contains(strings.Join(got, " "), field) {
+			t.Errorf("got errors of %v, want one of %s", got, field)
+		}
+	}
+
+	if _, err := LoadServer("serve", []string{"-config", writeConfig(t, "node.json", "{}")}); err == nil {
+		t.Fatal("loaded a json file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := dataDir(t)
+	valid := func() *Server {
+		c := DefaultServer()
+		c.DataDir = dir
+		c.defaultFiles()
+		return c
+	}
+
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("got %v for the defaults", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Server)
+		want   []string
+	}{
+		{"no node name", func(c *Server) { c.NodeName = "" }, []string{"node_name"}},
+		{"unknown log level", func(c *Server) { c.LogLevel = "trace" }, []string{"log_level"}},
+		{"empty segments", func(c *Server) { c.Segment = Segment{} }, []string{"segment.max_store_bytes", "segment.max_index_bytes"}},
+		{"missing file", func(c *Server) { c.TLS.PeerCertFile = filepath.Join(dir, "missing.pem") }, []string{"tls.peer_cert_file"}},
+		{"no authenticator", func(c *Server) { c.Authn.MTLS = false }, []string{"authn"}},
+		{
+			"tokens without optional client certificates",
+			func(c *Server) { c.Authn.KeySetFile = c.TLS.CAFile },
+			[]string{"tls.optional_client_cert"},
+		},
+		{"bad identity rule", func(c *Server) { c.Authn.IdentityRules = []string{"^(.*)$"} }, []string{"authn.identity_rules"}},
+		{"static without a file", func(c *Server) { c.Discovery.Backend = StaticBackend }, []string{"discovery.static_file"}},
+		{"unknown backend", func(c *Server) { c.Discovery.Backend = "consul" }, []string{"discovery.backend"}},
+		{"negative interval", func(c *Server) { c.Verify.Interval = -1 }, []string{"verify.interval"}},
+		{
+			"every invalid setting",
+			func(c *Server) { c.NodeName, c.RPC.BindAddr = "", "localhost" },
+			[]string{"node_name", "rpc.bind_addr"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.change(c)
+
+			got := fields(t, c.Validate())
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Fatalf("got errors of %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(ConfigEnv, writeConfig(t, "node.yaml", "data_dir: "+filepath.Join(dir, "from-file")+"\n"))
+
+	// the files don't exist yet, nothing is validated
+	c, err := LoadFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "from-file", "tls", "ca.pem"); c.TLS.CAFile != want {
+		t.Fatalf("got %s, want %s", c.TLS.CAFile, want)
+	}
+
+	// the node and its clients resolve the same files
+	t.Setenv("GOLOG_DATA_DIR", filepath.Join(dir, "from-env"))
+	t.Setenv("GOLOG_TLS_PEER_CERT_FILE", filepath.Join(dir, "peer.pem"))
+	c, err = LoadFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsDir := filepath.Join(dir, "from-env", "tls")
+	certFile, keyFile := c.ClientFiles("root")
+	for _, tt := range []struct{ got, want string }{
+		{c.TLS.CAFile, filepath.Join(tlsDir, "ca.pem")},
+		{c.CAKeyFile(), filepath.Join(tlsDir, "ca-key.pem")},
+		{c.TLS.CertFile, filepath.Join(tlsDir, "server.pem")},
+		{c.TLS.PeerCertFile, filepath.Join(dir, "peer.pem")},
+		{c.TLS.PeerKeyFile, filepath.Join(tlsDir, "peer-key.pem")},
+		{certFile, filepath.Join(tlsDir, "root-client.pem")},
+		{keyFile, filepath.Join(tlsDir, "root-client-key.pem")},
+		{c.ACL.ModelFile, filepath.Join(dir, "from-env", "acl", "model.conf")},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("got %s, want %s", tt.got, tt.want)
+		}
+	}
+
+	t.Setenv("GOLOG_SEGMENT_MAX_STORE_BYTES", "-1")
+	if _, err := LoadFiles(); err == nil {
+		t.Fatal("loaded an invalid setting")
+	}
+}
@@ -1,15 +1,14 @@
 package config
 
+// Config is the configuration of the log.
 type Config struct {
-	Segment struct {
-		MaxStoreBytes uint64
-		MaxIndexBytes uint64
-		InitialOffset uint64
-	}
+	// NodeName is the origin of the records produced to the log
+	NodeName string
+	Segment  Segment
 }
 
 type Segment struct {
-	MaxStoreBytes uint64
-	MaxIndexBytes uint64
-	InitialOffset uint64
+	MaxStoreBytes uint64 `yaml:"max_store_bytes" toml:"max_store_bytes"`
+	MaxIndexBytes uint64 `yaml:"max_index_bytes" toml:"max_index_bytes"`
+	InitialOffset uint64 `yaml:"initial_offset" toml:"initial_offset"`
 }
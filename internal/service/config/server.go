@@ -0,0 +1,357 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Server is the configuration of a node. It is loaded in layers:
+the defaults, then a YAML or TOML file, then the GOLOG_* environment
+variables and last the command line flags. Every setting has a key,
+e.g. segment.max_store_bytes, which is also its environment variable
+GOLOG_SEGMENT_MAX_STORE_BYTES and its flag -segment.max_store_bytes.
+*/
+
+// Server is the configuration of a node.
+type Server struct {
+	NodeName string `yaml:"node_name" toml:"node_name"`
+	// LogLevel is the lowest level logged: debug, info, warn or error
+	LogLevel  string          `yaml:"log_level" toml:"log_level"`
+	DataDir   string          `yaml:"data_dir" toml:"data_dir"`
+	Segment   Segment         `yaml:"segment" toml:"segment"`
+	Retention RetentionConfig `yaml:"retention" toml:"retention"`
+	RPC       RPCConfig       `yaml:"rpc" toml:"rpc"`
+	HTTP      HTTPConfig      `yaml:"http" toml:"http"`
+	TLS       ServerTLS       `yaml:"tls" toml:"tls"`
+	ACL       ACLConfig       `yaml:"acl" toml:"acl"`
+	Authn     AuthnConfig     `yaml:"authn" toml:"authn"`
+	Audit     AuditConfig     `yaml:"audit" toml:"audit"`
+	Discovery DiscoveryConfig `yaml:"discovery" toml:"discovery"`
+	Verify    VerifyConfig    `yaml:"verify" toml:"verify"`
+
+	// the flag set name and arguments it was loaded with
+	name string
+	args []string
+}
+
+type RPCConfig struct {
+	BindAddr string `yaml:"bind_addr" toml:"bind_addr"`
+}
+
+// HTTPConfig is the listener of the HTTP/JSON gateway,
+// the gateway is disabled without an address.
+type HTTPConfig struct {
+	BindAddr string `yaml:"bind_addr" toml:"bind_addr"`
+}
+
+// ServerTLS holds the certificates of the server and of its
+// connections to the other nodes.
+type ServerTLS struct {
+	CertFile     string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile      string `yaml:"key_file" toml:"key_file"`
+	CAFile       string `yaml:"ca_file" toml:"ca_file"`
+	PeerCertFile string `yaml:"peer_cert_file" toml:"peer_cert_file"`
+	PeerKeyFile  string `yaml:"peer_key_file" toml:"peer_key_file"`
+	// OptionalClientCert accepts clients authenticated with tokens
+	OptionalClientCert bool   `yaml:"optional_client_cert" toml:"optional_client_cert"`
+	CRLFile            string `yaml:"crl_file" toml:"crl_file"`
+	RevokedFile        string `yaml:"revoked_file" toml:"revoked_file"`
+}
+
+type ACLConfig struct {
+	ModelFile  string `yaml:"model_file" toml:"model_file"`
+	PolicyFile string `yaml:"policy_file" toml:"policy_file"`
+	// WatchInterval between the checks of the files, zero disables it
+	WatchInterval Duration `yaml:"watch_interval" toml:"watch_interval"`
+}
+
+type AuthnConfig struct {
+	MTLS        bool   `yaml:"mtls" toml:"mtls"`
+	KeySetFile  string `yaml:"key_set_file" toml:"key_set_file"`
+	APIKeysFile string `yaml:"api_keys_file" toml:"api_keys_file"`
+	// IdentityFormats render the subject of a certificate, e.g. {uri}
+	IdentityFormats []string `yaml:"identity_formats" toml:"identity_formats"`
+	// IdentityRules rewrite the subjects, each is "<regexp> => <replacement>"
+	IdentityRules []string `yaml:"identity_rules" toml:"identity_rules"`
+}
+
+// RetentionConfig bounds the log, a zero limit is not enforced.
+type RetentionConfig struct {
+	MaxAge     Duration `yaml:"max_age" toml:"max_age"`
+	MaxRecords uint64   `yaml:"max_records" toml:"max_records"`
+}
+
+type AuditConfig struct {
+	Enabled    bool     `yaml:"enabled" toml:"enabled"`
+	MaxAge     Duration `yaml:"max_age" toml:"max_age"`
+	MaxRecords uint64   `yaml:"max_records" toml:"max_records"`
+}
+
+type DiscoveryConfig struct {
+	// Backend is serf, static or dns
+	Backend        string   `yaml:"backend" toml:"backend"`
+	BindAddr       string   `yaml:"bind_addr" toml:"bind_addr"`
+	StartJoinAddrs []string `yaml:"start_join_addrs" toml:"start_join_addrs"`
+	EncryptKey     string   `yaml:"encrypt_key" toml:"encrypt_key"`
+	Role           string   `yaml:"role" toml:"role"`
+	Rack           string   `yaml:"rack" toml:"rack"`
+	Zone           string   `yaml:"zone" toml:"zone"`
+	StaticFile     string   `yaml:"static_file" toml:"static_file"`
+	DNSService     string   `yaml:"dns_service" toml:"dns_service"`
+	DNSProto       string   `yaml:"dns_proto" toml:"dns_proto"`
+	DNSName        string   `yaml:"dns_name" toml:"dns_name"`
+	DNSResolver    string   `yaml:"dns_resolver" toml:"dns_resolver"`
+	Interval       Duration `yaml:"interval" toml:"interval"`
+}
+
+type VerifyConfig struct {
+	// Interval of the background verification, zero disables it
+	Interval Duration `yaml:"interval" toml:"interval"`
+	Repair   bool     `yaml:"repair" toml:"repair"`
+}
+
+// discovery backends
+const (
+	SerfBackend   = "serf"
+	StaticBackend = "static"
+	DNSBackend    = "dns"
+)
+
+// Duration is a time.Duration written as "1m30s" in the files.
+type Duration time.Duration
+
+func (self Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(self).String()), nil
+}
+
+func (self *Duration) UnmarshalText(b []byte) error {
+	d, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+
+	*self = Duration(d)
+	return nil
+}
+
+// DefaultServer returns the configuration of a single node.
+// The certificate and ACL files are left empty, they default
+// to the data directory once it is known.
+func DefaultServer() *Server {
+	hostname, _ := os.Hostname()
+
+	return &Server{
+		NodeName: hostname,
+		LogLevel: "info",
+		DataDir:  "./data",
+		Segment: Segment{
+			MaxStoreBytes: 1024,
+			MaxIndexBytes: 1024,
+		},
+		RPC: RPCConfig{BindAddr: "127.0.0.1:8400"},
+		ACL: ACLConfig{
+			WatchInterval: Duration(5 * time.Second),
+		},
+		Authn: AuthnConfig{MTLS: true},
+		Discovery: DiscoveryConfig{
+			Backend:  SerfBackend,
+			BindAddr: "127.0.0.1:8401",
+			Role:     "voter",
+			DNSProto: "tcp",
+			Interval: Duration(5 * time.Second),
+		},
+	}
+}
+
+// FieldError is an invalid setting.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (self FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", self.Field, self.Message)
+}
+
+// ValidationError lists the invalid settings.
+type ValidationError []FieldError
+
+func (self ValidationError) Error() string {
+	msgs := make([]string, len(self))
+	for i, e := range self {
+		msgs[i] = e.Error()
+	}
+
+	return "invalid config:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// Validate checks every setting and returns a ValidationError
+// with all the invalid ones.
+func (self *Server) Validate() error {
+	var errs ValidationError
+	check := func(ok bool, field, msg string) {
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Message: msg})
+		}
+	}
+
+	check(self.NodeName != "", "node_name", "is required")
+	check(self.DataDir != "", "data_dir", "is required")
+	switch self.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log_level", "must be debug, info, warn or error")
+	}
+	check(self.Segment.MaxStoreBytes > 0, "segment.max_store_bytes", "must be positive")
+	check(self.Segment.MaxIndexBytes > 0, "segment.max_index_bytes", "must be positive")
+	check(validAddr(self.RPC.BindAddr), "rpc.bind_addr", "must be a host:port address")
+	if self.HTTP.BindAddr != "" {
+		check(validAddr(self.HTTP.BindAddr), "http.bind_addr", "must be a host:port address")
+	}
+
+	check(self.TLS.CertFile != "", "tls.cert_file", "is required")
+	check(self.TLS.KeyFile != "", "tls.key_file", "is required")
+	check(self.TLS.CAFile != "", "tls.ca_file", "is required")
+	for _, f := range []struct{ field, path string }{
+		{"tls.cert_file", self.TLS.CertFile},
+		{"tls.key_file", self.TLS.KeyFile},
+		{"tls.ca_file", self.TLS.CAFile},
+		{"tls.peer_cert_file", self.TLS.PeerCertFile},
+		{"tls.peer_key_file", self.TLS.PeerKeyFile},
+		{"acl.model_file", self.ACL.ModelFile},
+		{"acl.policy_file", self.ACL.PolicyFile},
+		{"authn.key_set_file", self.Authn.KeySetFile},
+		{"authn.api_keys_file", self.Authn.APIKeysFile},
+	} {
+		check(f.path == "" || exists(f.path), f.field, fmt.Sprintf("%s doesn't exist", f.path))
+	}
+	check(self.ACL.ModelFile != "", "acl.model_file", "is required")
+	check(self.ACL.PolicyFile != "", "acl.policy_file", "is required")
+	check(self.ACL.WatchInterval >= 0, "acl.watch_interval", "can't be negative")
+
+	check(
+		self.Authn.MTLS || self.Authn.KeySetFile != "" || self.Authn.APIKeysFile != "",
+		"authn", "enable mtls, a key set or api keys",
+	)
+	check(
+		self.Authn.KeySetFile == "" && self.Authn.APIKeysFile == "" || self.TLS.OptionalClientCert,
+		"tls.optional_client_cert", "must be set for clients authenticated without certificates",
+	)
+	for _, r := range self.Authn.IdentityRules {
+		check(strings.Contains(r, "=>"), "authn.identity_rules", fmt.Sprintf("%q is not \"<regexp> => <replacement>\"", r))
+	}
+
+	check(self.Retention.MaxAge >= 0, "retention.max_age", "can't be negative")
+	check(self.Audit.MaxAge >= 0, "audit.max_age", "can't be negative")
+
+	switch self.Discovery.Backend {
+	case SerfBackend:
+		check(validAddr(self.Discovery.BindAddr), "discovery.bind_addr", "must be a host:port address")
+		for _, addr := range self.Discovery.StartJoinAddrs {
+			check(validAddr(addr), "discovery.start_join_addrs", fmt.Sprintf("%q must be a host:port address", addr))
+		}
+	case StaticBackend:
+		check(self.Discovery.StaticFile != "", "discovery.static_file", "is required by the static backend")
+	case DNSBackend:
+		check(self.Discovery.DNSName != "", "discovery.dns_name", "is required by the dns backend")
+	case "":
+	default:
+		check(false, "discovery.backend", "must be serf, static, dns or empty")
+	}
+	switch self.Discovery.Role {
+	case "voter", "learner", "mirror":
+	default:
+		check(false, "discovery.role", "must be voter, learner or mirror")
+	}
+	check(self.Discovery.Interval >= 0, "discovery.interval", "can't be negative")
+	check(self.Verify.Interval >= 0, "verify.interval", "can't be negative")
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Print writes the effective configuration as YAML, without secrets.
+func (self *Server) Print(w io.Writer) error {
+	c := *self
+	if c.Discovery.EncryptKey != "" {
+		c.Discovery.EncryptKey = "<redacted>"
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&c); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// LogDir returns the directory of the log.
+func (self *Server) LogDir() string {
+	return filepath.Join(self.DataDir, "log")
+}
+
+// CAKeyFile returns the key of the CA, next to its certificate.
+// Only the node the certificates are issued on holds it.
+func (self *Server) CAKeyFile() string {
+	return filepath.Join(filepath.Dir(self.TLS.CAFile), "ca-key.pem")
+}
+
+// ClientFiles returns the certificate and key of a client of the
+// node, next to the CA, e.g. tls/root-client.pem.
+func (self *Server) ClientFiles(name string) (string, string) {
+	dir := filepath.Dir(self.TLS.CAFile)
+	return filepath.Join(dir, name+"-client.pem"), filepath.Join(dir, name+"-client-key.pem")
+}
+
+// defaultFiles sets the certificate and ACL files that aren't
+// set to their place under the data directory, e.g. tls/server.pem.
+func (self *Server) defaultFiles() {
+	tlsDir := filepath.Join(self.DataDir, "tls")
+	aclDir := filepath.Join(self.DataDir, "acl")
+
+	for _, f := range []struct {
+		path *string
+		def  string
+	}{
+		{&self.TLS.CertFile, filepath.Join(tlsDir, "server.pem")},
+		{&self.TLS.KeyFile, filepath.Join(tlsDir, "server-key.pem")},
+		{&self.TLS.CAFile, filepath.Join(tlsDir, "ca.pem")},
+		{&self.TLS.PeerCertFile, filepath.Join(tlsDir, "peer.pem")},
+		{&self.TLS.PeerKeyFile, filepath.Join(tlsDir, "peer-key.pem")},
+		{&self.TLS.CRLFile, filepath.Join(tlsDir, "crl.pem")},
+		{&self.TLS.RevokedFile, filepath.Join(tlsDir, "revoked.txt")},
+		{&self.ACL.ModelFile, filepath.Join(aclDir, "model.conf")},
+		{&self.ACL.PolicyFile, filepath.Join(aclDir, "policy.csv")},
+	} {
+		if *f.path == "" {
+			*f.path = f.def
+		}
+	}
+}
+
+// KeyringFile returns the file of the gossip encryption keys.
+func (self *Server) KeyringFile() string {
+	return filepath.Join(self.DataDir, "keyring.json")
+}
+
+func validAddr(addr string) bool {
+	_, _, err := net.SplitHostPort(addr)
+	return err == nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -3,61 +3,214 @@ package config
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"sync"
+	"time"
 )
 
+// reloadInterval is the minimum time between two checks of the files
+const reloadInterval = time.Second
+
 type TLSConfig struct {
-	CertFile      string
-	KeyFile       string
-	CAFile        string
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// ServerAddress is the name the server is verified against,
+	// gRPC connections without one use the host they dial
 	ServerAddress string
 	Server        bool
+	// OptionalClientCert lets clients connect without a certificate
+	// to authenticate with a token or an api key instead
+	OptionalClientCert bool
 }
 
-// SetupTLSConfig sets up the TLS config from the files
+// SetupTLSConfig sets up the TLS config from the files.
+// The files are reloaded on the handshakes that follow a change,
+// so rotated certificates are used without a restart.
 func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	w := &tlsWatcher{TLSConfig: cfg}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+
 	// load the tls config from the files
-	var err error
 	tlsConfig := &tls.Config{}
-	if cfg.CertFile != "" && cfg.KeyFile != "" {
-		tlsConfig.Certificates = make([]tls.Certificate, 1)
-		tlsConfig.Certificates[0], err = tls.LoadX509KeyPair(
-			cfg.CertFile,
-			cfg.KeyFile,
-		)
+	if w.cert != nil {
+		// no static Certificates, the server would present them
+		// to the clients that send no server name, like IP dials
+		tlsConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return w.certificate(), nil
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return w.certificate(), nil
+		}
+	}
+
+	// set the client and server certs
+	if w.ca != nil {
+		if cfg.Server {
+			tlsConfig.ClientCAs = w.ca
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			if cfg.OptionalClientCert {
+				tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+
+			// every handshake verifies the client with the current CA
+			tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				c := tlsConfig.Clone()
+				c.ClientCAs = w.pool()
+				c.GetConfigForClient = nil
+				return c, nil
+			}
+		} else {
+			tlsConfig.RootCAs = w.ca
+
+			// the server is verified below with the current CA,
+			// the RootCAs can't be replaced after the setup
+			tlsConfig.InsecureSkipVerify = true
+			tlsConfig.VerifyConnection = w.verifyServer
+		}
+		tlsConfig.ServerName = cfg.ServerAddress
+	}
+
+	return tlsConfig, nil
+}
+
+// tlsWatcher holds the key pair and the CA of the files
+// and reloads them when the files change.
+type tlsWatcher struct {
+	TLSConfig
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	ca       *x509.CertPool
+	modTimes [3]time.Time
+	checked  time.Time
+}
+
+// certificate returns the current key pair.
+func (self *tlsWatcher) certificate() *tls.Certificate {
+	self.reload()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.cert
+}
+
+// pool returns the current CA.
+func (self *tlsWatcher) pool() *x509.CertPool {
+	self.reload()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.ca
+}
+
+// verifyServer verifies the certificate chain of the server with the current CA.
+func (self *tlsWatcher) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         self.pool(),
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// reload loads the files again when they changed since the last load.
+// The current certificates are kept if the new ones fail to load.
+func (self *tlsWatcher) reload() {
+	self.mu.Lock()
+	if time.Since(self.checked) < reloadInterval {
+		self.mu.Unlock()
+		return
+	}
+	self.checked = time.Now()
+	modTimes := self.stat()
+	changed := self.modTimes != modTimes
+	// a failed load is not retried until the files change again
+	self.modTimes = modTimes
+	self.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := self.load(); err != nil {
+		log.Printf("[ERROR] golog: failed to reload tls files: %s", err)
+	}
+}
+
+// load reads the key pair and the CA.
+func (self *tlsWatcher) load() error {
+	// the times are read first, a change while loading is picked up next time
+	modTimes := self.stat()
+
+	var (
+		cert *tls.Certificate
+		ca   *x509.CertPool
+	)
+
+	if self.CertFile != "" && self.KeyFile != "" {
+		c, err := tls.LoadX509KeyPair(self.CertFile, self.KeyFile)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		cert = &c
 	}
 
 	// load the CA if it exists
-	if cfg.CAFile != "" {
-		// load the CA
-		b, err := os.ReadFile(cfg.CAFile)
+	if self.CAFile != "" {
+		b, err := os.ReadFile(self.CAFile)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		// append the CA
-		ca := x509.NewCertPool()
-		ok := ca.AppendCertsFromPEM([]byte(b))
+		ca = x509.NewCertPool()
+		ok := ca.AppendCertsFromPEM(b)
 		if !ok {
-			return nil, fmt.Errorf(
+			return fmt.Errorf(
 				"failed to parse root certificate: %q",
-				cfg.CAFile,
+				self.CAFile,
 			)
 		}
+	}
 
-		// set the client and server certs
-		if cfg.Server {
-			tlsConfig.ClientCAs = ca
-			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-		} else {
-			tlsConfig.RootCAs = ca
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.cert = cert
+	self.ca = ca
+	self.modTimes = modTimes
+
+	return nil
+}
+
+// stat returns the modification times of the files.
+func (self *tlsWatcher) stat() [3]time.Time {
+	var times [3]time.Time
+	for i, path := range []string{self.CertFile, self.KeyFile, self.CAFile} {
+		if path == "" {
+			continue
+		}
+
+		if info, err := os.Stat(path); err == nil {
+			times[i] = info.ModTime()
 		}
-		tlsConfig.ServerName = cfg.ServerAddress
 	}
 
-	return tlsConfig, nil
+	return times
 }
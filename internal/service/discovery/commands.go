@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+/*
+Cluster-wide commands are sent to every member through serf.
+A command sent without waiting is a user event, a command that
+waits for the results is a query and every member responds
+with the result of its handler.
+*/
+
+const (
+	// commandPrefix keeps the commands apart from other events
+	commandPrefix = "golog-cmd:"
+
+	// maxResultBytes keeps the result within serf's response limit
+	maxResultBytes = 900
+
+	resultOK    byte = 0
+	resultError byte = 1
+)
+
+// CommandHandler executes a cluster-wide command on the local node.
+type CommandHandler func(args []byte) (string, error)
+
+// CommandResult is the result of a command on a single node.
+type CommandResult struct {
+	Node   string
+	Output string
+	Error  string
+}
+
+// Register registers the handler of a cluster-wide command.
+func (self *Membership) Register(name string, handler CommandHandler) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.commands == nil {
+		self.commands = make(map[string]CommandHandler)
+	}
+
+	self.commands[name] = handler
+}
+
+// Broadcast sends a command to every member. When wait is set it
+// collects the results of the members that respond before the timeout,
+// otherwise it returns as soon as the command is sent.
+func (self *Membership) Broadcast(
+	name string,
+	args []byte,
+	wait bool,
+	timeout time.Duration,
+) ([]CommandResult, error) {
+	if !wait {
+		return nil, self.serf.UserEvent(commandPrefix+name, args, false)
+	}
+
+	params := self.serf.DefaultQueryParams()
+	if timeout > 0 {
+		params.Timeout = timeout
+	}
+
+	res, err := self.serf.Query(commandPrefix+name, args, params)
+	if err != nil {
+		return nil, err
+	}
+
+	responded := make(map[string]CommandResult)
+	for r := range res.ResponseCh() {
+		responded[r.From] = decodeResult(r.From, r.Payload)
+	}
+
+	// report the members that didn't respond in time
+	for _, m := range self.serf.Members() {
+		if _, ok := responded[m.Name]; !ok && m.Status == serf.StatusAlive {
+			responded[m.Name] = CommandResult{Node: m.Name, Error: "no response"}
+		}
+	}
+
+	results := make([]CommandResult, 0, len(responded))
+	for _, r := range responded {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Node < results[j].Node
+	})
+
+	return results, nil
+}
+
+// handleCommand executes a command received as a user event or a query.
+func (self *Membership) handleCommand(name string, args []byte, query *serf.Query) {
+	name = strings.TrimPrefix(name, commandPrefix)
+
+	self.mu.Lock()
+	handler, ok := self.commands[name]
+	self.mu.Unlock()
+
+	var (
+		output string
+		err    error
+	)
+	if ok {
+		output, err = handler(args)
+	} else {
+		err = fmt.Errorf("unknown command: %q", name)
+	}
+
+	if err != nil {
+		log.Printf("[ERROR] golog: failed to execute command %s: %s", name, err)
+	}
+
+	if query == nil {
+		return
+	}
+
+	if err := query.Respond(encodeResult(output, err)); err != nil {
+		log.Printf("[ERROR] golog: failed to respond to command %s: %s", name, err)
+	}
+}
+
+// encodeResult encodes the result of a handler as a query response.
+func encodeResult(output string, err error) []byte {
+	status, msg := resultOK, output
+	if err != nil {
+		status, msg = resultError, err.Error()
+	}
+
+	if len(msg) > maxResultBytes {
+		msg = msg[:maxResultBytes]
+	}
+
+	return append([]byte{status}, msg...)
+}
+
+// decodeResult decodes a query response.
+func decodeResult(node string, payload []byte) CommandResult {
+	r := CommandResult{Node: node}
+	if len(payload) == 0 {
+		r.Error = "empty response"
+		return r
+	}
+
+	if payload[0] == resultError {
+		r.Error = string(payload[1:])
+	} else {
+		r.Output = string(payload[1:])
+	}
+
+	return r
+}
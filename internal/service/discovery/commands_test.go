@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandResults(t *testing.T) {
+	long := strings.Repeat("x", 2*maxResultBytes)
+
+	tests := []struct {
+		name   string
+		output string
+		err    error
+		want   CommandResult
+	}{
+		{"output", "ok", nil, CommandResult{Node: "node-0", Output: "ok"}},
+		{"empty output", "", nil, CommandResult{Node: "node-0"}},
+		{"error", "ignored", errors.New("failed"), CommandResult{Node: "node-0", Error: "failed"}},
+		{"truncated output", long, nil, CommandResult{Node: "node-0", Output: long[:maxResultBytes]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeResult("node-0", encodeResult(tt.output, tt.err))
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := decodeResult("node-0", nil); got.Error != "empty response" {
+		t.Fatalf("got %+v from an empty response", got)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	var members []*Membership
+	var join []string
+	for i := 0; i < 3; i++ {
+		m := startMember(t, Config{
+			NodeName:       fmt.Sprintf("node-%d", i),
+			StartJoinAddrs: join,
+		})
+		members = append(members, m)
+		join = []string{members[0].BindAddr}
+	}
+	alive(t, members[0], "node-0", "node-1", "node-2")
+
+	ran := make(chan string, 10)
+	for i, m := range members {
+		name := fmt.Sprintf("node-%d", i)
+		// node-2 doesn't know the command
+		if i == 2 {
+			continue
+		}
+		m.Register("echo", func(args []byte) (string, error) {
+			ran <- name
+			if string(args) == "fail" {
+				return "", errors.New("failed on " + name)
+			}
+			return name + ": " + string(args), nil
+		})
+	}
+
+	results, err := members[0].Broadcast("echo", []byte("hello"), true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CommandResult{
+		{Node: "node-0", Output: "node-0: hello"},
+		{Node: "node-1", Output: "node-1: hello"},
+		{Node: "node-2", Error: `unknown command: "echo"`},
+	}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Fatalf("got %+v, want %+v", results, want)
+	}
+
+	results, err = members[0].Broadcast("echo", []byte("fail"), true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1].Error != "failed on node-1" {
+		t.Fatalf("got %+v, want the error of node-1", results)
+	}
+
+	// drain the handlers run by the queries
+	for len(ran) > 0 {
+		<-ran
+	}
+
+	// without waiting, the command is a user event
+	results, err = members[0].Broadcast("echo", []byte("event"), false, 0)
+	if err != nil || results != nil {
+		t.Fatalf("got %v, %v, want no results", results, err)
+	}
+
+	seen := make(map[string]bool)
+	deadline := time.After(5 * time.Second)
+	for len(seen) < 2 {
+		select {
+		case name := <-ran:
+			seen[name] = true
+		case <-deadline:
+			t.Fatalf("the event ran on %v, want node-0 and node-1", seen)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+The DNS backend polls the SRV records of the cluster,
+for example _golog._tcp.cluster.local. Every target becomes a node
+named and addressed by its host and port.
+*/
+
+// DNSConfig is used to configure the DNS backend.
+type DNSConfig struct {
+	NodeName string
+	RPCAddr  string
+	// the SRV record looked up is _Service._Proto.Name
+	Service string
+	Proto   string
+	Name    string
+	// Resolver is the address of the DNS server,
+	// the system resolver is used when it is empty
+	Resolver string
+	// Interval between lookups
+	Interval time.Duration
+}
+
+// DNS discovers the nodes from DNS SRV records.
+type DNS struct {
+	DNSConfig
+	tracker  *tracker
+	resolver *net.Resolver
+	close    chan struct{}
+	leave    sync.Once
+}
+
+var _ Discovery = (*DNS)(nil)
+
+// NewDNS looks up the nodes and keeps polling the resolver.
+func NewDNS(handler Handler, config DNSConfig) (*DNS, error) {
+	if config.Interval == 0 {
+		config.Interval = 5 * time.Second
+	}
+	if config.Proto == "" {
+		config.Proto = "tcp"
+	}
+
+	d := &DNS{
+		DNSConfig: config,
+		tracker: &tracker{
+			handler:   handler,
+			localName: config.NodeName,
+			localAddr: config.RPCAddr,
+		},
+		resolver: net.DefaultResolver,
+		close:    make(chan struct{}),
+	}
+
+	// send every query to the configured server
+	if config.Resolver != "" {
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, config.Resolver)
+			},
+		}
+	}
+
+	if err := d.lookup(); err != nil {
+		return nil, err
+	}
+
+	go d.poll()
+
+	return d, nil
+}
+
+// poll looks up the nodes until the backend leaves.
+func (self *DNS) poll() {
+	ticker := time.NewTicker(self.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-self.close:
+			return
+		case <-ticker.C:
+			// keep the current nodes if the lookup fails
+			if err := self.lookup(); err != nil {
+				log.Printf("[ERROR] golog: failed to look up nodes: %s", err)
+			}
+		}
+	}
+}
+
+// lookup resolves the SRV records and drives the handler with them.
+func (self *DNS) lookup() error {
+	ctx, cancel := context.WithTimeout(context.Background(), self.Interval)
+	defer cancel()
+
+	_, srvs, err := self.resolver.LookupSRV(ctx, self.Service, self.Proto, self.Name)
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]Node, 0, len(srvs))
+	for _, srv := range srvs {
+		addr := net.JoinHostPort(
+			strings.TrimSuffix(srv.Target, "."),
+			strconv.Itoa(int(srv.Port)),
+		)
+		nodes = append(nodes, Node{Name: addr, RPCAddr: addr})
+	}
+
+	self.tracker.set(nodes)
+
+	return nil
+}
+
+// Nodes returns the nodes of the last lookup.
+func (self *DNS) Nodes() []Node {
+	return self.tracker.list()
+}
+
+// Leave stops polling the resolver.
+func (self *DNS) Leave() error {
+	self.leave.Do(func() { close(self.close) })
+	return nil
+}
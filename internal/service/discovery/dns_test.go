@@ -0,0 +1,155 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsServer stands in for the DNS server,
+// answering the SRV queries with its targets.
+type dnsServer struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	targets []dnsmessage.SRVResource
+}
+
+func newDNSServer(t *testing.T) *dnsServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &dnsServer{conn: conn}
+	go s.serve()
+
+	return s
+}
+
+// set replaces the targets, given as host and port pairs.
+func (self *dnsServer) set(targets ...string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.targets = nil
+	for _, target := range targets {
+		host, port, _ := net.SplitHostPort(target)
+
+		var p uint16
+		fmt.Sscan(port, &p)
+
+		self.targets = append(self.targets, dnsmessage.SRVResource{
+			Target: dnsmessage.MustNewName(host + "."),
+			Port:   p,
+		})
+	}
+}
+
+func (self *dnsServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := self.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		res, err := self.answer(buf[:n])
+		if err != nil {
+			continue
+		}
+		self.conn.WriteTo(res, addr)
+	}
+}
+
+func (self *dnsServer) answer(req []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(req)
+	if err != nil {
+		return nil, err
+	}
+	question, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:            header.ID,
+		Response:      true,
+		Authoritative: true,
+	})
+	b.EnableCompression()
+	b.StartQuestions()
+	b.Question(question)
+	b.StartAnswers()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if question.Type == dnsmessage.TypeSRV {
+		for _, target := range self.targets {
+			err := b.SRVResource(dnsmessage.ResourceHeader{
+				Name:  question.Name,
+				Class: dnsmessage.ClassINET,
+				TTL:   1,
+			}, target)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b.Finish()
+}
+
+func TestDNSFollowsRecords(t *testing.T) {
+	server := newDNSServer(t)
+	server.set("node-0.cluster.local:8400", "node-1.cluster.local:8400")
+
+	handler := &recorder{}
+	d, err := NewDNS(handler, DNSConfig{
+		RPCAddr:  "node-0.cluster.local:8400",
+		Service:  "golog",
+		Name:     "cluster.local",
+		Resolver: server.conn.LocalAddr().String(),
+		Interval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Leave()
+
+	// the local node is never joined
+	want := []string{"join node-1.cluster.local:8400 node-1.cluster.local:8400"}
+	if got := handler.take(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	server.set("node-0.cluster.local:8400", "node-2.cluster.local:8400")
+
+	want = []string{
+		"leave node-1.cluster.local:8400 node-1.cluster.local:8400",
+		"join node-2.cluster.local:8400 node-2.cluster.local:8400",
+	}
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(got) < len(want) && time.Now().Before(deadline) {
+		got = append(got, handler.take()...)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	nodes := d.Nodes()
+	if len(nodes) != 1 || nodes[0].RPCAddr != "node-2.cluster.local:8400" {
+		t.Fatalf("got nodes %v", nodes)
+	}
+}
@@ -1,9 +1,19 @@
 package discovery
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"net"
+	"os"
+	"strings"
+	"sync"
 
+	"github.com/hashicorp/memberlist"
 	"github.com/hashicorp/serf/serf"
 )
 
@@ -12,34 +22,94 @@ This package implements the Membership service
 to manage the cluster members.
 This is necessary for the distributed logging service.
 It uses the serf package to manage the cluster members.
+The Static and DNS backends are used where serf's gossip ports
+are blocked, they drive the same Handler.
 */
 
 // Handler is used to handle join and leave events
 type Handler interface {
-	Join(name, addr string) error
-	Leave(name, addr string) error
+	Join(node Node) error
+	Leave(node Node) error
 }
 
+// Updater is implemented by handlers that want to know
+// when a member changes its descriptor.
+type Updater interface {
+	Update(node Node) error
+}
+
+// Discovery is a backend that drives a Handler
+// with the nodes of the cluster.
+type Discovery interface {
+	Nodes() []Node
+	Leave() error
+}
+
+var _ Discovery = (*Membership)(nil)
+
 // Membership manages the cluster members.
 type Membership struct {
 	Config
 	handler Handler
 	serf    *serf.Serf
 	events  chan serf.Event
+
+	mu       sync.Mutex
+	node     Node
+	commands map[string]CommandHandler
+	// members handed to the handler, by name
+	members map[string]Node
+
+	watchMu  sync.Mutex
+	watchers map[chan struct{}]struct{}
 }
 
 // Config is used to configure the Membership.
 type Config struct {
-	NodeName       string
-	BindAddr       string
+	NodeName string
+	BindAddr string
+	RPCAddr  string
+	Role     Role
+	Rack     string
+	Zone     string
+	Topics   []string
+	// Tags are published along with the node descriptor
 	Tags           map[string]string
 	StartJoinAddrs []string
+	// EncryptKey is the base64 encoded gossip encryption key,
+	// members that can't decrypt the gossip are rejected
+	EncryptKey string
+	// KeyringFile persists the keys installed since, it's loaded
+	// over EncryptKey on start so the rotations survive restarts
+	KeyringFile string
+	// LogOutput receives the logs of serf, the standard error when nil
+	LogOutput io.Writer
 }
 
 func New(handler Handler, config Config) (*Membership, error) {
+	if config.Role == "" {
+		config.Role = RoleVoter
+	}
+
+	// copy the tags and topics, the caller changing them
+	// afterwards must not change the published descriptor
+	own := Node{Topics: config.Topics, Tags: config.Tags}.clone()
+	config.Topics, config.Tags = own.Topics, own.Tags
+
 	c := &Membership{
 		Config:  config,
 		handler: handler,
+		node: Node{
+			Name:          config.NodeName,
+			RPCAddr:       config.RPCAddr,
+			Role:          config.Role,
+			Rack:          config.Rack,
+			Zone:          config.Zone,
+			FormatVersion: FormatVersion,
+			Topics:        config.Topics,
+			Tags:          config.Tags,
+		},
+		members: make(map[string]Node),
 	}
 	if err := c.setupSerf(); err != nil {
 		return nil, err
@@ -61,11 +131,40 @@ func (self *Membership) setupSerf() error {
 	config.Init()
 	config.MemberlistConfig.BindAddr = addr.IP.String()
 	config.MemberlistConfig.BindPort = addr.Port
+	config.NodeName = self.NodeName
+	config.Tags = self.node.tags()
+	if self.LogOutput != nil {
+		config.LogOutput = self.LogOutput
+		config.MemberlistConfig.LogOutput = self.LogOutput
+	}
+
+	// encrypt and verify the gossip
+	keys, err := self.keys()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		keyring, err := memberlist.NewKeyring(keys, keys[0])
+		if err != nil {
+			return err
+		}
+
+		config.MemberlistConfig.Keyring = keyring
+		config.MemberlistConfig.GossipVerifyIncoming = true
+		config.MemberlistConfig.GossipVerifyOutgoing = true
+	}
+	config.KeyringFile = self.KeyringFile
+
+	self.events = make(chan serf.Event)
+	config.EventCh = self.events
 	self.serf, err = serf.Create(config)
 	if err != nil {
 		return err
 	}
 
+	// serf picks the hostname when no node name is set
+	self.node.Name = self.serf.LocalMember().Name
+
 	// Listen for events
 	go self.eventHandler()
 
@@ -74,6 +173,7 @@ func (self *Membership) setupSerf() error {
 	if self.StartJoinAddrs != nil {
 		_, err = self.serf.Join(self.StartJoinAddrs, true)
 		if err != nil {
+			self.serf.Shutdown()
 			return err
 		}
 	}
@@ -81,10 +181,49 @@ func (self *Membership) setupSerf() error {
 	return nil
 }
 
+// keys returns the gossip encryption keys, the primary first.
+// serf writes the keyring file when the keys change,
+// so it wins over the configured key.
+func (self *Membership) keys() ([][]byte, error) {
+	var encoded []string
+	if self.KeyringFile != "" {
+		p, err := os.ReadFile(self.KeyringFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if err == nil {
+			err = json.Unmarshal(p, &encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keyring file %s: %w", self.KeyringFile, err)
+			}
+		}
+	}
+
+	if len(encoded) == 0 && self.EncryptKey != "" {
+		encoded = []string{self.EncryptKey}
+	}
+
+	keys := make([][]byte, len(encoded))
+	for i, key := range encoded {
+		var err error
+		keys[i], err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
 // eventHandler listens for serf events
 // and handles join and leave events
 func (self *Membership) eventHandler() {
 	for e := range self.events {
+		if _, ok := e.(serf.MemberEvent); ok {
+			self.notify()
+		}
+
 		switch e.EventType() {
 		// handle member join event
 		case serf.EventMemberJoin:
@@ -96,6 +235,27 @@ func (self *Membership) eventHandler() {
 				// join the cluster
 				self.handleJoin(member)
 			}
+		// handle member update event
+		case serf.EventMemberUpdate:
+			for _, member := range e.(serf.MemberEvent).Members {
+				// ignore local member
+				if self.isLocal(member) {
+					continue
+				}
+				// update the member descriptor
+				self.handleUpdate(member)
+			}
+		// handle cluster-wide commands
+		case serf.EventUser:
+			event := e.(serf.UserEvent)
+			if strings.HasPrefix(event.Name, commandPrefix) {
+				go self.handleCommand(event.Name, event.Payload, nil)
+			}
+		case serf.EventQuery:
+			query := e.(*serf.Query)
+			if strings.HasPrefix(query.Name, commandPrefix) {
+				go self.handleCommand(query.Name, query.Payload, query)
+			}
 		// handle member leave event
 		case serf.EventMemberLeave, serf.EventMemberFailed:
 			for _, member := range e.(serf.MemberEvent).Members {
@@ -111,29 +271,130 @@ func (self *Membership) eventHandler() {
 }
 
 func (self *Membership) handleJoin(member serf.Member) {
-	err := self.handler.Join(member.Name, member.Tags["rpc_addr"])
+	node := NodeFromMember(member)
+
+	self.mu.Lock()
+	self.members[node.Name] = node
+	self.mu.Unlock()
+
+	join(self.handler, node)
+}
+
+func (self *Membership) handleUpdate(member serf.Member) {
+	node := NodeFromMember(member)
+
+	self.mu.Lock()
+	old, ok := self.members[node.Name]
+	self.members[node.Name] = node
+	self.mu.Unlock()
+
+	if !ok {
+		join(self.handler, node)
+		return
+	}
+
+	update(self.handler, old, node)
+}
+
+func (self *Membership) handleLeave(member serf.Member) {
+	node := NodeFromMember(member)
+
+	self.mu.Lock()
+	delete(self.members, node.Name)
+	self.mu.Unlock()
+
+	leave(self.handler, node)
+}
+
+func join(handler Handler, node Node) {
+	err := handler.Join(node)
 	if err != nil {
 		log.Printf(
-			"[ERROR] golog: failed to join member %s: %s",
-			member.Name,
-			member.Tags["rpc_addr"],
+			"[ERROR] golog: failed to join member %s: %s: %s",
+			node.Name,
+			node.RPCAddr,
+			err,
 		)
 	}
 }
 
-func (self *Membership) handleLeave(member serf.Member) {
-	err := self.handler.Leave(member.Name, member.Tags["rpc_addr"])
+// update hands a changed node to the handler. The handlers know
+// the nodes by their RPC address, so a node that moved is left
+// at the old address and joined at the new one.
+func update(handler Handler, old, node Node) {
+	if old.RPCAddr != node.RPCAddr {
+		leave(handler, old)
+		join(handler, node)
+		return
+	}
+
+	updater, ok := handler.(Updater)
+	if !ok {
+		return
+	}
+
+	err := updater.Update(node)
+	if err != nil {
+		log.Printf(
+			"[ERROR] golog: failed to update member %s: %s: %s",
+			node.Name,
+			node.RPCAddr,
+			err,
+		)
+	}
+}
+
+func leave(handler Handler, node Node) {
+	err := handler.Leave(node)
 	if err != nil {
 		log.Printf(
-			"[ERROR] golog: failed to leave member %s: %s",
-			member.Name,
-			member.Tags["rpc_addr"],
+			"[ERROR] golog: failed to leave member %s: %s: %s",
+			node.Name,
+			node.RPCAddr,
+			err,
 		)
 	}
 }
 
 func (self *Membership) isLocal(m serf.Member) bool {
-	return m.Addr.String() == self.BindAddr
+	return m.Name == self.serf.LocalMember().Name
+}
+
+// Node returns the descriptor of the local node.
+func (self *Membership) Node() Node {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.node
+}
+
+// Update changes the descriptor of the local node and publishes it
+// to the cluster without rejoining.
+func (self *Membership) Update(update func(node *Node)) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	node := self.node.clone()
+	update(&node)
+
+	err := self.serf.SetTags(node.tags())
+	if err != nil {
+		return err
+	}
+
+	self.node = node
+	return nil
+}
+
+// Nodes returns the descriptors of every member.
+func (self *Membership) Nodes() []Node {
+	members := self.serf.Members()
+	nodes := make([]Node, 0, len(members))
+	for _, m := range members {
+		nodes = append(nodes, NodeFromMember(m))
+	}
+
+	return nodes
 }
 
 func (self *Membership) Members() []serf.Member {
@@ -141,5 +402,66 @@ func (self *Membership) Members() []serf.Member {
 }
 
 func (self *Membership) Leave() error {
+	defer self.notify()
 	return self.serf.Leave()
 }
+
+// Watch returns a channel signaled when a member joins, changes
+// or leaves, the local node included, and a function to stop watching.
+// Signals are coalesced, the members must be read again on each one.
+func (self *Membership) Watch() (<-chan struct{}, func()) {
+	self.watchMu.Lock()
+	defer self.watchMu.Unlock()
+
+	if self.watchers == nil {
+		self.watchers = make(map[chan struct{}]struct{})
+	}
+
+	ch := make(chan struct{}, 1)
+	self.watchers[ch] = struct{}{}
+
+	return ch, func() {
+		self.watchMu.Lock()
+		defer self.watchMu.Unlock()
+
+		delete(self.watchers, ch)
+	}
+}
+
+// notify signals the watchers without blocking.
+func (self *Membership) notify() {
+	self.watchMu.Lock()
+	defer self.watchMu.Unlock()
+
+	for ch := range self.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// LocalMember returns the member of the local node.
+func (self *Membership) LocalMember() serf.Member {
+	return self.serf.LocalMember()
+}
+
+// InstallKey installs a gossip encryption key on every member.
+func (self *Membership) InstallKey(key string) (*serf.KeyResponse, error) {
+	return self.serf.KeyManager().InstallKey(key)
+}
+
+// UseKey makes an installed key the primary gossip encryption key.
+func (self *Membership) UseKey(key string) (*serf.KeyResponse, error) {
+	return self.serf.KeyManager().UseKey(key)
+}
+
+// RemoveKey removes a key that is no longer primary from every member.
+func (self *Membership) RemoveKey(key string) (*serf.KeyResponse, error) {
+	return self.serf.KeyManager().RemoveKey(key)
+}
+
+// ListKeys lists the keys installed on the members.
+func (self *Membership) ListKeys() (*serf.KeyResponse, error) {
+	return self.serf.KeyManager().ListKeys()
+}
@@ -0,0 +1,175 @@
+package discovery
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// startMember starts a member joining the cluster of the join addresses.
+func startMember(t *testing.T, config Config) *Membership {
+	t.Helper()
+
+	config.BindAddr = freeAddr(t)
+	config.RPCAddr = freeAddr(t)
+	config.LogOutput = io.Discard
+
+	m, err := New(&recorder{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Leave()
+		m.serf.Shutdown()
+	})
+
+	return m
+}
+
+// alive waits for the member to see the named members alive.
+func alive(t *testing.T, m *Membership, names ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		seen := make(map[string]bool)
+		for _, member := range m.Members() {
+			seen[member.Name] = member.Status == serf.StatusAlive
+		}
+
+		all := true
+		for _, name := range names {
+			all = all && seen[name]
+		}
+		if all {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("members %v are not alive: %v", names, seen)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// keyringFile returns the keys written to the keyring file.
+func keyringFile(t *testing.T, path string) []string {
+	t.Helper()
+
+	p, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	if err := json.Unmarshal(p, &keys); err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func TestKeyringSurvivesRestart(t *testing.T) {
+	oldKey, newKey := newKey(t), newKey(t)
+
+	var members []*Membership
+	var files []string
+	var join []string
+	for i := 0; i < 3; i++ {
+		files = append(files, filepath.Join(t.TempDir(), "keyring.json"))
+		m := startMember(t, Config{
+			NodeName:       fmt.Sprintf("node-%d", i),
+			EncryptKey:     oldKey,
+			KeyringFile:    files[i],
+			StartJoinAddrs: join,
+		})
+		members = append(members, m)
+		join = []string{members[0].BindAddr}
+	}
+	alive(t, members[0], "node-0", "node-1", "node-2")
+
+	// rotate the key of the whole cluster
+	for _, rotate := range []func(string) (*serf.KeyResponse, error){
+		members[0].InstallKey,
+		members[0].UseKey,
+	} {
+		res, err := rotate(newKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.NumErr != 0 {
+			t.Fatalf("rotation failed: %v", res.Messages)
+		}
+	}
+	res, err := members[0].RemoveKey(oldKey)
+	if err != nil || res.NumErr != 0 {
+		t.Fatalf("removing the old key failed: %v %v", err, res)
+	}
+
+	// every member persisted the rotation
+	for i, file := range files {
+		keys := keyringFile(t, file)
+		if len(keys) != 1 || keys[0] != newKey {
+			t.Fatalf("node-%d persisted %v, want [%s]", i, keys, newKey)
+		}
+	}
+
+	// node-2 restarts with the old key in its config,
+	// the keyring file lets it join the rotated cluster
+	members[2].Leave()
+	members[2].serf.Shutdown()
+
+	restarted := startMember(t, Config{
+		NodeName:       "node-2",
+		EncryptKey:     oldKey,
+		KeyringFile:    files[2],
+		StartJoinAddrs: join,
+	})
+	alive(t, members[0], "node-0", "node-1", "node-2")
+	alive(t, restarted, "node-0", "node-1", "node-2")
+
+	// without the keyring file the old key is rejected
+	_, err = New(&recorder{}, Config{
+		NodeName:       "node-3",
+		BindAddr:       freeAddr(t),
+		RPCAddr:        freeAddr(t),
+		EncryptKey:     oldKey,
+		StartJoinAddrs: join,
+		LogOutput:      io.Discard,
+	})
+	if err == nil {
+		t.Fatal("a member with the removed key joined")
+	}
+}
@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+// FormatVersion is the version of the data format written by this node
+const FormatVersion = 1
+
+// Role of a node in the cluster
+type Role string
+
+const (
+	RoleVoter   Role = "voter"
+	RoleLearner Role = "learner"
+	RoleMirror  Role = "mirror"
+)
+
+// tags published through serf
+const (
+	rpcAddrTag       = "rpc_addr"
+	roleTag          = "role"
+	rackTag          = "rack"
+	zoneTag          = "zone"
+	formatVersionTag = "format_version"
+	topicsTag        = "topics"
+	drainingTag      = "draining"
+)
+
+// Node describes a member of the cluster.
+type Node struct {
+	Name          string
+	RPCAddr       string
+	Role          Role
+	Rack          string
+	Zone          string
+	FormatVersion int
+	Topics        []string
+	// Draining nodes don't accept new records and are about to leave
+	Draining bool
+	// Tags holds the tags that are not part of the descriptor
+	Tags map[string]string
+}
+
+// clone returns a copy of the node that shares no slice or map with it.
+func (self Node) clone() Node {
+	if self.Topics != nil {
+		self.Topics = append([]string(nil), self.Topics...)
+	}
+
+	tags := make(map[string]string, len(self.Tags))
+	for k, v := range self.Tags {
+		tags[k] = v
+	}
+	self.Tags = tags
+
+	return self
+}
+
+// NodeFromMember decodes the descriptor published by a member.
+func NodeFromMember(m serf.Member) Node {
+	return nodeFromTags(m.Name, m.Tags)
+}
+
+// nodeFromTags decodes a descriptor from its tags.
+func nodeFromTags(name string, tags map[string]string) Node {
+	node := Node{
+		Name:    name,
+		RPCAddr: tags[rpcAddrTag],
+		Role:    Role(tags[roleTag]),
+		Rack:    tags[rackTag],
+		Zone:    tags[zoneTag],
+		Tags:    make(map[string]string),
+	}
+
+	node.FormatVersion, _ = strconv.Atoi(tags[formatVersionTag])
+	node.Draining, _ = strconv.ParseBool(tags[drainingTag])
+
+	if topics := tags[topicsTag]; topics != "" {
+		node.Topics = strings.Split(topics, ",")
+	}
+
+	for k, v := range tags {
+		switch k {
+		case rpcAddrTag, roleTag, rackTag, zoneTag, formatVersionTag, topicsTag, drainingTag:
+		default:
+			node.Tags[k] = v
+		}
+	}
+
+	return node
+}
+
+// tags encodes the descriptor as serf tags.
+func (self Node) tags() map[string]string {
+	tags := make(map[string]string, len(self.Tags)+7)
+	for k, v := range self.Tags {
+		tags[k] = v
+	}
+
+	tags[rpcAddrTag] = self.RPCAddr
+	tags[roleTag] = string(self.Role)
+	tags[formatVersionTag] = strconv.Itoa(self.FormatVersion)
+	if self.Rack != "" {
+		tags[rackTag] = self.Rack
+	}
+	if self.Zone != "" {
+		tags[zoneTag] = self.Zone
+	}
+	if len(self.Topics) > 0 {
+		tags[topicsTag] = strings.Join(self.Topics, ",")
+	}
+	if self.Draining {
+		tags[drainingTag] = strconv.FormatBool(self.Draining)
+	}
+
+	return tags
+}
@@ -0,0 +1,166 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+The static backend reads the nodes from a peer list file.
+Each line holds a node name, its rpc address
+and optional key=value tags, for example:
+
+	node-1 10.0.0.1:8400 role=voter zone=eu-1
+	node-2 10.0.0.2:8400 role=learner topics=orders,payments
+
+Empty lines and lines starting with # are ignored.
+The file is watched and the handler is driven by its changes.
+*/
+
+// StaticConfig is used to configure the Static backend.
+type StaticConfig struct {
+	NodeName string
+	RPCAddr  string
+	// Path of the peer list file
+	Path string
+	// Interval between checks of the file for changes
+	Interval time.Duration
+}
+
+// Static discovers the nodes from a peer list file.
+type Static struct {
+	StaticConfig
+	tracker *tracker
+
+	modTime time.Time
+	size    int64
+	close   chan struct{}
+	leave   sync.Once
+}
+
+var _ Discovery = (*Static)(nil)
+
+// NewStatic reads the peer list file and watches it for changes.
+func NewStatic(handler Handler, config StaticConfig) (*Static, error) {
+	if config.Interval == 0 {
+		config.Interval = 5 * time.Second
+	}
+
+	s := &Static{
+		StaticConfig: config,
+		tracker: &tracker{
+			handler:   handler,
+			localName: config.NodeName,
+			localAddr: config.RPCAddr,
+		},
+		close: make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	go s.watch()
+
+	return s, nil
+}
+
+// watch reloads the file when its size or modification time changes.
+func (self *Static) watch() {
+	ticker := time.NewTicker(self.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-self.close:
+			return
+		case <-ticker.C:
+			fi, err := os.Stat(self.Path)
+			if err != nil {
+				log.Printf("[ERROR] golog: failed to stat peer list: %s", err)
+				continue
+			}
+
+			if fi.ModTime().Equal(self.modTime) && fi.Size() == self.size {
+				continue
+			}
+
+			// keep the current nodes if the file is broken
+			if err := self.load(); err != nil {
+				log.Printf("[ERROR] golog: failed to load peer list: %s", err)
+			}
+		}
+	}
+}
+
+// load reads the file and drives the handler with its nodes.
+func (self *Static) load() error {
+	fi, err := os.Stat(self.Path)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(self.Path)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := parsePeers(b)
+	if err != nil {
+		return err
+	}
+
+	self.modTime = fi.ModTime()
+	self.size = fi.Size()
+	self.tracker.set(nodes)
+
+	return nil
+}
+
+// parsePeers parses the content of a peer list file.
+func parsePeers(b []byte) ([]Node, error) {
+	var nodes []Node
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a name and an rpc address", line)
+		}
+
+		tags := map[string]string{rpcAddrTag: fields[1]}
+		for _, field := range fields[2:] {
+			k, v, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key=value, got %q", line, field)
+			}
+			tags[k] = v
+		}
+
+		nodes = append(nodes, nodeFromTags(fields[0], tags))
+	}
+
+	return nodes, scanner.Err()
+}
+
+// Nodes returns the nodes of the peer list.
+func (self *Static) Nodes() []Node {
+	return self.tracker.list()
+}
+
+// Leave stops watching the peer list.
+func (self *Static) Leave() error {
+	self.leave.Do(func() { close(self.close) })
+	return nil
+}
@@ -0,0 +1,90 @@
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStaticFollowsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# peers\nnode-0 10.0.0.0:8400\nnode-1 10.0.0.1:8400 zone=eu-1\n")
+
+	handler := &recorder{}
+	s, err := NewStatic(handler, StaticConfig{
+		NodeName: "node-0",
+		RPCAddr:  "10.0.0.0:8400",
+		Path:     path,
+		Interval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Leave()
+
+	// the local node is never joined
+	want := []string{"join node-1 10.0.0.1:8400"}
+	if got := handler.take(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// a broken file keeps the current nodes
+	write("node-2\n")
+	time.Sleep(50 * time.Millisecond)
+	if got := handler.take(); len(got) != 0 {
+		t.Fatalf("got %q from a broken file", got)
+	}
+
+	write("node-0 10.0.0.0:8400\nnode-2 10.0.0.2:8400\n")
+	want = []string{"leave node-1 10.0.0.1:8400", "join node-2 10.0.0.2:8400"}
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(got) < len(want) && time.Now().Before(deadline) {
+		got = append(got, handler.take()...)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLeaveTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStatic(&recorder{}, StaticConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newDNSServer(t)
+	server.set("node-0.cluster.local:8400")
+
+	d, err := NewDNS(&recorder{}, DNSConfig{
+		Service:  "golog",
+		Name:     "cluster.local",
+		Resolver: server.conn.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, backend := range []Discovery{s, d} {
+		if err := backend.Leave(); err != nil {
+			t.Fatal(err)
+		}
+		if err := backend.Leave(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
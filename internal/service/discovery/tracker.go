@@ -0,0 +1,80 @@
+package discovery
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// tracker drives a handler from the full list of nodes
+// reported by the polling backends.
+type tracker struct {
+	mu      sync.Mutex
+	handler Handler
+	// the local node is never handled
+	localName string
+	localAddr string
+	nodes     map[string]Node
+}
+
+// set joins the new nodes, updates the changed ones,
+// moves the ones whose address changed and leaves the nodes that are gone.
+func (self *tracker) set(nodes []Node) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	next := make(map[string]Node, len(nodes))
+	for _, node := range nodes {
+		if self.isLocal(node) {
+			continue
+		}
+		next[node.Name] = node
+	}
+
+	for name, node := range self.nodes {
+		if _, ok := next[name]; ok {
+			continue
+		}
+
+		leave(self.handler, node)
+	}
+
+	for name, node := range next {
+		old, ok := self.nodes[name]
+		if !ok {
+			join(self.handler, node)
+			continue
+		}
+
+		if reflect.DeepEqual(old, node) {
+			continue
+		}
+
+		update(self.handler, old, node)
+	}
+
+	self.nodes = next
+}
+
+// list returns the tracked nodes sorted by name.
+func (self *tracker) list() []Node {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	nodes := make([]Node, 0, len(self.nodes))
+	for _, node := range self.nodes {
+		nodes = append(nodes, node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	return nodes
+}
+
+func (self *tracker) isLocal(node Node) bool {
+	return node.Name == "" ||
+		(self.localName != "" && node.Name == self.localName) ||
+		(self.localAddr != "" && node.RPCAddr == self.localAddr)
+}
@@ -0,0 +1,87 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// recorder records the calls made to a handler.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (self *recorder) Join(node Node) error   { return self.record("join", node) }
+func (self *recorder) Leave(node Node) error  { return self.record("leave", node) }
+func (self *recorder) Update(node Node) error { return self.record("update", node) }
+
+func (self *recorder) record(event string, node Node) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.events = append(self.events, fmt.Sprintf("%s %s %s", event, node.Name, node.RPCAddr))
+	return nil
+}
+
+// take returns the recorded calls and forgets them.
+func (self *recorder) take() []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	events := self.events
+	self.events = nil
+	return events
+}
+
+func TestTrackerSet(t *testing.T) {
+	handler := &recorder{}
+	tracker := &tracker{handler: handler, localName: "local"}
+
+	tests := []struct {
+		name  string
+		nodes []Node
+		want  []string
+	}{
+		{
+			name: "joins new nodes",
+			nodes: []Node{
+				{Name: "local", RPCAddr: "10.0.0.0:8400"},
+				{Name: "node-1", RPCAddr: "10.0.0.1:8400"},
+			},
+			want: []string{"join node-1 10.0.0.1:8400"},
+		},
+		{
+			name:  "ignores unchanged nodes",
+			nodes: []Node{{Name: "node-1", RPCAddr: "10.0.0.1:8400"}},
+		},
+		{
+			name:  "updates changed nodes",
+			nodes: []Node{{Name: "node-1", RPCAddr: "10.0.0.1:8400", Zone: "eu-1"}},
+			want:  []string{"update node-1 10.0.0.1:8400"},
+		},
+		{
+			name:  "moves nodes to their new address",
+			nodes: []Node{{Name: "node-1", RPCAddr: "10.0.0.2:8400", Zone: "eu-1"}},
+			want: []string{
+				"leave node-1 10.0.0.1:8400",
+				"join node-1 10.0.0.2:8400",
+			},
+		},
+		{
+			name: "leaves nodes that are gone",
+			want: []string{"leave node-1 10.0.0.2:8400"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker.set(tt.nodes)
+
+			got := handler.take()
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
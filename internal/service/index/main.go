@@ -37,10 +37,14 @@ func New(f *os.File, c *config.Config) (*Index, error) {
 	}
 
 	idx.Size = uint64(fi.Size())
-	if err = os.Truncate(
-		f.Name(),
-		int64(c.Segment.MaxIndexBytes),
-	); err != nil {
+
+	// the limit may have been lowered since the index was written,
+	// the entries it holds are kept
+	size := c.Segment.MaxIndexBytes
+	if idx.Size > size {
+		size = idx.Size
+	}
+	if err = os.Truncate(f.Name(), int64(size)); err != nil {
 		return nil, err
 	}
 
@@ -101,8 +105,8 @@ func (self *Index) Read(in int64) (out uint32, pos uint64, err error) {
 
 	// Get the position
 	pos = uint64(out) * entWidth
-	// EOF if the position is beyond the end of the index
-	if pos > self.Size {
+	// EOF if the entry is beyond the end of the index
+	if pos+entWidth > self.Size {
 		return 0, 0, io.EOF
 	}
 
@@ -131,3 +135,20 @@ func (self *Index) Write(off uint32, pos uint64) error {
 
 	return nil
 }
+
+// IsMaxed reports whether another entry exceeds max bytes
+func (self *Index) IsMaxed(max uint64) bool {
+	return self.Size+entWidth > max
+}
+
+// Cap returns the bytes the index can hold
+func (self *Index) Cap() uint64 {
+	return uint64(len(self.mmap))
+}
+
+// Shrink keeps only the first n entries of the index
+func (self *Index) Shrink(n uint64) {
+	if n*entWidth < self.Size {
+		self.Size = n * entWidth
+	}
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"logger/internal/domain"
+	"os"
+	"path"
+)
+
+/*
+The topics and the origins are rebuilt from the records, see topics.go
+and origins.go. So the whole log isn't read again on every open and
+rewind, they are written to a checkpoint file when a segment is rolled
+and after a replay. Only the records from the offset of the checkpoint
+on are replayed. The checkpoint is ignored when it's ahead of the log,
+e.g. the last records were lost in a crash, and removed when the
+records it covers are rewound.
+*/
+
+// checkpointFile is the name of the checkpoint in the log dir
+const checkpointFile = "checkpoint.json"
+
+// checkpoint is the state of the topics and the origins
+// after the records below an offset.
+type checkpoint struct {
+	Next    uint64            `json:"next"`
+	Topics  []checkpointTopic `json:"topics"`
+	Origins map[string]uint64 `json:"origins"`
+}
+
+// checkpointTopic is a topic and the offset of its last change.
+type checkpointTopic struct {
+	domain.Topic
+	Offset uint64 `json:"offset"`
+}
+
+// loadCheckpoint reads the checkpoint of the log dir, an unreadable
+// one is ignored and the records are replayed from the start.
+func (self *Log) loadCheckpoint() error {
+	b, err := os.ReadFile(path.Join(self.Dir, checkpointFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var c checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		log.Printf("[ERROR] golog: ignoring invalid checkpoint of %s: %s", self.Dir, err)
+		return nil
+	}
+	self.checkpoint = &c
+
+	return nil
+}
+
+// saveCheckpoint writes the topics and the origins as of the end of
+// the log, the lock must be held.
+func (self *Log) saveCheckpoint() error {
+	c := &checkpoint{
+		Next:    self.activeSegment.NextOffset,
+		Origins: make(map[string]uint64, len(self.origins)),
+	}
+	for _, t := range self.topics {
+		c.Topics = append(c.Topics, checkpointTopic{Topic: t.Topic, Offset: t.offset})
+	}
+	for origin, next := range self.origins {
+		c.Origins[origin] = next
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	// replaced at once, so a crash leaves the previous one
+	p := path.Join(self.Dir, checkpointFile)
+	if err := os.WriteFile(p+".tmp", b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(p+".tmp", p); err != nil {
+		return err
+	}
+
+	self.checkpoint = c
+
+	return nil
+}
+
+// removeCheckpoint drops the checkpoint covering the offset,
+// the lock must be held.
+func (self *Log) removeCheckpoint(offset uint64) error {
+	if self.checkpoint == nil || self.checkpoint.Next <= offset {
+		return nil
+	}
+
+	self.checkpoint = nil
+	err := os.Remove(path.Join(self.Dir, checkpointFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// restoreCheckpoint loads the topics and the origins of the checkpoint
+// and returns the offset to replay from, the lock must be held.
+// The records truncated since the checkpoint are skipped, the topics
+// they changed were restored above them.
+func (self *Log) restoreCheckpoint() uint64 {
+	lowest := self.segments[0].BaseOffset
+	c := self.checkpoint
+	if c == nil || c.Next > self.activeSegment.NextOffset {
+		return lowest
+	}
+
+	for _, t := range c.Topics {
+		self.topics[t.Name] = &topicState{Topic: t.Topic, offset: t.Offset}
+	}
+	for origin, next := range c.Origins {
+		self.origins[origin] = next
+	}
+
+	return max(c.Next, lowest)
+}
@@ -0,0 +1,123 @@
+package logger_test
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/domain"
+	"logger/internal/service/config"
+	logger "logger/internal/service/log"
+)
+
+// topicNames returns the names of the topics of the log.
+func topicNames(t *testing.T, l *logger.Log) []string {
+	t.Helper()
+
+	topics, err := l.Topics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, topic := range topics {
+		names = append(names, topic.Name)
+	}
+	return names
+}
+
+func TestCheckpointKeepsTruncatedOrigins(t *testing.T) {
+	dir := t.TempDir()
+	c := &config.Config{NodeName: "node-a", Segment: config.Segment{MaxIndexBytes: 36}}
+
+	l, err := logger.New(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the records replicated from node-b fill the segment at 0
+	for off := uint64(0); off < 3; off++ {
+		if _, err := l.Append(&v1.Record{Value: []byte("b"), Origin: "node-b", OriginOffset: off}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := l.CreateTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = logger.New(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// the truncated records aren't replicated again
+	if next := l.NextOriginOffset("node-b"); next != 3 {
+		t.Fatalf("got next origin offset %d, want 3", next)
+	}
+	if _, err := l.Append(&v1.Record{Value: []byte("b"), Origin: "node-b", OriginOffset: 1}); err == nil {
+		t.Fatal("appended a truncated record again")
+	}
+	if got := topicNames(t, l); !reflect.DeepEqual(got, []string{"orders"}) {
+		t.Fatalf("got topics %v, want [orders]", got)
+	}
+}
+
+func TestRewindBelowTheCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	c := &config.Config{NodeName: "node-a"}
+
+	l, err := logger.New(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the checkpoints are taken as the segments are rolled
+	for _, name := range []string{"orders", "payments"} {
+		if _, err := l.CreateTopic(name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Roll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Rewind(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := topicNames(t, l); !reflect.DeepEqual(got, []string{"orders"}) {
+		t.Fatalf("got topics %v, want [orders]", got)
+	}
+
+	// the record at 1 is another one after the rewind
+	if _, err := l.CreateTopic("refunds"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = logger.New(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	topics, err := l.Topics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.Topic{
+		{Name: "orders", CreatedAt: 0},
+		{Name: "refunds", CreatedAt: 1},
+	}
+	if !reflect.DeepEqual(topics, want) {
+		t.Fatalf("got topics %+v, want %+v", topics, want)
+	}
+}
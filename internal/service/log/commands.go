@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"fmt"
+	"logger/internal/service/discovery"
+	"strconv"
+	"strings"
+)
+
+// Commands returns the cluster-wide commands that act on the log.
+func (self *Log) Commands() map[string]discovery.CommandHandler {
+	return map[string]discovery.CommandHandler{
+		// roll the active segment
+		"roll-segment": func(args []byte) (string, error) {
+			base, err := self.Roll()
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("active segment starts at %d", base), nil
+		},
+		// force retention by removing the segments below an offset
+		"truncate": func(args []byte) (string, error) {
+			lowest, err := strconv.ParseUint(strings.TrimSpace(string(args)), 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("expected the lowest offset to keep: %w", err)
+			}
+
+			err = self.Truncate(lowest)
+			if err != nil {
+				return "", err
+			}
+
+			off, err := self.LowestOffset()
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("lowest offset is %d", off), nil
+		},
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	v1 "logger/gen/go/v1"
+	"logger/internal/domain"
 	filerepo "logger/internal/repository/file"
 	"logger/internal/service/config"
 	"logger/internal/service/segment"
@@ -28,6 +29,20 @@ type Log struct {
 
 	activeSegment *segment.Segment
 	segments      []*segment.Segment
+
+	// created topics, loaded when the log is opened
+	topics map[string]*topicState
+	// next origin offset of every origin, loaded with the topics
+	origins map[string]uint64
+	// topics and origins as of an offset, see checkpoint.go
+	checkpoint *checkpoint
+
+	// called before the segments are truncated
+	beforeTruncate []func(lowest uint64) error
+
+	// limits enforced by Retain, see retention.go
+	retention     Retention
+	stopRetention chan struct{}
 }
 
 // HARDCODE
@@ -50,11 +65,18 @@ func New(dir string, c *config.Config) (*Log, error) {
 		return nil, err
 	}
 
-	// Parse the file names and keep only the offsets.
+	// Parse the file names and keep only the offsets,
+	// once for the store, index and checksum of a segment.
 	var baseOffsets []uint64
+	seen := make(map[uint64]bool)
 	for _, file := range files {
 		offStr := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
-		off, _ := strconv.ParseUint(offStr, 10, 0)
+		off, err := strconv.ParseUint(offStr, 10, 0)
+		// not a segment, e.g. the checkpoint
+		if err != nil || seen[off] {
+			continue
+		}
+		seen[off] = true
 		baseOffsets = append(baseOffsets, off)
 	}
 
@@ -69,8 +91,6 @@ func New(dir string, c *config.Config) (*Log, error) {
 		if err != nil {
 			return nil, err
 		}
-
-		i++
 	}
 
 	// If segments are found, set the active segment to the last one.
@@ -81,6 +101,20 @@ func New(dir string, c *config.Config) (*Log, error) {
 		}
 	}
 
+	// the limits may have been lowered since the last segment was written
+	if s := l.activeSegment; s.IsMaxed() && s.NextOffset > s.BaseOffset {
+		if err := l.newSegment(s.NextOffset); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.loadCheckpoint(); err != nil {
+		return nil, err
+	}
+	if err := l.replay(); err != nil {
+		return nil, err
+	}
+
 	return l, nil
 }
 
@@ -89,22 +123,28 @@ func (self *Log) Append(record *v1.Record) (uint64, error) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
-	fmt.Printf("Append: %+v\n", record)
+	return self.append(record)
+}
+
+// append appends the record, the lock must be held.
+func (self *Log) append(record *v1.Record) (uint64, error) {
+	if err := self.stamp(record); err != nil {
+		return 0, err
+	}
 
 	// Append the record to the active segment.
 	off, err := self.activeSegment.Append(record)
 	if err != nil {
-		fmt.Println("Log Append err: ", err)
 		return 0, err
 	}
 
-	fmt.Println("Append offset: ", off)
+	self.apply(record)
+
 	// If the active segment is full, flush and create a new one.
 	if self.activeSegment.IsMaxed() {
-		err = self.newSegment(off + 1)
+		err = self.roll(off + 1)
 	}
 
-	fmt.Println("Append err: ", err)
 	return off, err
 }
 
@@ -132,6 +172,13 @@ func (self *Log) Read(offset uint64) (*v1.Record, error) {
 // Close closes the log
 func (self *Log) Close() error {
 	fmt.Println("Log close")
+	self.mu.Lock()
+	if self.stopRetention != nil {
+		close(self.stopRetention)
+		self.stopRetention = nil
+	}
+	self.mu.Unlock()
+
 	for _, segment := range self.segments {
 		if err := segment.Close(); err != nil {
 			fmt.Println("Segment close err: ", err)
@@ -184,15 +231,119 @@ func (self *Log) HighestOffset() (uint64, error) {
 	return off - 1, nil
 }
 
-// Truncate removes all segments whose base offset is lower than lowest
+// Truncate removes the segments holding only records below lowest,
+// the records at and above it are kept.
 // it is necessary because we don't have an infinite diskspace
 func (self *Log) Truncate(lowest uint64) error {
+	// let the records that must outlive the segments be copied first
+	self.mu.RLock()
+	hooks := self.beforeTruncate
+	self.mu.RUnlock()
+
+	for _, fn := range hooks {
+		if err := fn(lowest); err != nil {
+			return err
+		}
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// the segments are sorted, so the removed ones come first
+	var removed []*segment.Segment
+	for _, s := range self.segments {
+		// the active segment is always kept
+		if s.NextOffset > lowest || s == self.activeSegment {
+			break
+		}
+		removed = append(removed, s)
+	}
+
+	// the topics are written again before their changes are removed,
+	// the appends may add segments that are kept
+	if err := self.restoreTopics(removed); err != nil {
+		return err
+	}
+
+	for _, s := range removed {
+		if err := s.Remove(); err != nil {
+			return err
+		}
+	}
+
+	self.segments = self.segments[len(removed):]
+
+	return nil
+}
+
+// BeforeTruncate registers a function called with the lowest offset
+// kept, before the segments below it are removed by Truncate.
+func (self *Log) BeforeTruncate(fn func(lowest uint64) error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.beforeTruncate = append(self.beforeTruncate, fn)
+}
+
+// Roll seals the active segment and starts a new one
+// at the next offset. It returns the base offset of the new segment.
+func (self *Log) Roll() (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	next := self.activeSegment.NextOffset
+
+	// an empty segment is not rolled
+	if next == self.activeSegment.BaseOffset {
+		return next, nil
+	}
+
+	return next, self.roll(next)
+}
+
+// Checksum returns the rolling checksum of the records in [start, end)
+// and the number of records hashed.
+func (self *Log) Checksum(start, end uint64) (uint64, uint64, error) {
+	// segments cache their checksum, so take the write lock
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var sum, count uint64
+	for _, s := range self.segments {
+		if s.NextOffset <= start || end <= s.BaseOffset {
+			continue
+		}
+
+		segSum, segCount, err := s.Checksum(start, end, s != self.activeSegment)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		sum, count = segment.CombineChecksums(sum, count, segSum, segCount)
+	}
+
+	return sum, count, nil
+}
+
+// Rewind removes all records from the offset onwards,
+// so they can be fetched again from another node.
+func (self *Log) Rewind(offset uint64) error {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
+	return self.rewind(offset)
+}
+
+// rewind removes the records from the offset onwards,
+// the lock must be held.
+func (self *Log) rewind(offset uint64) error {
+	if err := self.removeCheckpoint(offset); err != nil {
+		return err
+	}
+
 	var segments []*segment.Segment
 	for _, s := range self.segments {
-		if s.NextOffset <= lowest+1 {
+		if s.BaseOffset >= offset {
 			err := s.Remove()
 			if err != nil {
 				return err
@@ -200,12 +351,57 @@ func (self *Log) Truncate(lowest uint64) error {
 			continue
 		}
 
+		err := s.Rewind(offset)
+		if err != nil {
+			return err
+		}
+
 		segments = append(segments, s)
 	}
 
 	self.segments = segments
 
-	return nil
+	// the last segment left becomes the active one
+	if len(self.segments) == 0 {
+		if err := self.newSegment(offset); err != nil {
+			return err
+		}
+	} else {
+		self.activeSegment = self.segments[len(self.segments)-1]
+	}
+
+	// the removed records may have changed the topics and origins
+	return self.replay()
+}
+
+// replay rebuilds the topics and the origins from the checkpoint
+// and the records after it, the lock must be held.
+func (self *Log) replay() error {
+	self.topics = make(map[string]*topicState)
+	self.origins = make(map[string]uint64)
+
+	start := self.restoreCheckpoint()
+	for _, s := range self.segments {
+		for off := max(start, s.BaseOffset); off < s.NextOffset; off++ {
+			record, err := s.Read(off)
+			if err != nil {
+				return err
+			}
+
+			self.apply(record)
+		}
+	}
+
+	return self.saveCheckpoint()
+}
+
+// apply updates the topics and the origins with an appended record,
+// the lock must be held.
+func (self *Log) apply(record *v1.Record) {
+	if record.Topic == TopicsTopic {
+		self.applyTopic(record)
+	}
+	self.applyOrigin(record)
 }
 
 // Reader returns an io.Reader to read the whole log
@@ -235,6 +431,47 @@ func (self *OriginReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
+// Segments describes the segments of the log.
+func (self *Log) Segments() []domain.Segment {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	segments := make([]domain.Segment, len(self.segments))
+	for i, s := range self.segments {
+		indexBytes, maxIndexBytes := s.IndexSize()
+		segments[i] = domain.Segment{
+			BaseOffset:    s.BaseOffset,
+			NextOffset:    s.NextOffset,
+			StoreBytes:    s.Store.Size,
+			IndexBytes:    indexBytes,
+			MaxIndexBytes: maxIndexBytes,
+			Active:        s == self.activeSegment,
+		}
+	}
+
+	return segments
+}
+
+// SetSegment changes the limits of the segments created from now on,
+// the existing segments keep the limits they were created with.
+func (self *Log) SetSegment(c config.Segment) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	next := *self.Config
+	next.Segment = c
+	self.Config = &next
+}
+
+// roll starts a new active segment at the offset and checkpoints
+// the topics and the origins, the lock must be held.
+func (self *Log) roll(baseOffset uint64) error {
+	if err := self.newSegment(baseOffset); err != nil {
+		return err
+	}
+	return self.saveCheckpoint()
+}
+
 // newSegment creates a new segment from a base offset and appends it to the log
 func (self *Log) newSegment(baseOffset uint64) error {
 	segment, err := segment.New(self.Dir, baseOffset, self.Config)
@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"fmt"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/segment"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+Every record keeps its origin, the node it was first appended to,
+and its offset there. The records produced to a node get the name
+of the node and their own offset, the replicated ones keep those of
+their source. Each node assigns its own offsets to the records it
+replicates, so replicas are compared by origin instead: the records
+of an origin are in the order of their origin offsets on every node.
+
+A record of an origin below the last one appended is rejected with
+AlreadyExists, so the records replicated twice are appended once.
+*/
+
+// originRecord is a record of an origin in the local log.
+type originRecord struct {
+	offset       uint64
+	originOffset uint64
+	hash         uint64
+}
+
+// stamp sets the origin of the records produced to the node and
+// rejects the records of an origin that were already appended,
+// the lock must be held.
+func (self *Log) stamp(record *v1.Record) error {
+	if record.Origin == "" {
+		record.Origin = self.Config.NodeName
+		record.OriginOffset = self.activeSegment.NextOffset
+		return nil
+	}
+
+	if next, ok := self.origins[record.Origin]; ok && record.OriginOffset < next {
+		return status.Errorf(
+			codes.AlreadyExists,
+			"record %d of %s is already appended",
+			record.OriginOffset,
+			record.Origin,
+		)
+	}
+
+	return nil
+}
+
+// applyOrigin moves the next offset of the origin of a record,
+// the lock must be held.
+func (self *Log) applyOrigin(record *v1.Record) {
+	if next := record.OriginOffset + 1; next > self.origins[record.Origin] {
+		self.origins[record.Origin] = next
+	}
+}
+
+// Origin returns the origin of the records produced to the log.
+func (self *Log) Origin() string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.Config.NodeName
+}
+
+// NextOriginOffset returns the offset following the last record
+// of the origin in the log, zero when it has none.
+func (self *Log) NextOriginOffset(origin string) uint64 {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.origins[origin]
+}
+
+// OwnChecksum returns the rolling checksum of the records in
+// [start, end) the log is the origin of, and the number of records hashed.
+func (self *Log) OwnChecksum(start, end uint64) (uint64, uint64, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	var sum, count uint64
+	for _, s := range self.segments {
+		for off := max(start, s.BaseOffset); off < min(end, s.NextOffset); off++ {
+			record, err := s.Read(off)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			if record.Origin == self.Config.NodeName {
+				sum, count = segment.CombineChecksums(sum, count, segment.HashRecord(record), 1)
+			}
+		}
+	}
+
+	return sum, count, nil
+}
+
+// originRecords returns the records of the origin in the log,
+// in the order they were appended, and the next offset of the log.
+func (self *Log) originRecords(origin string) ([]originRecord, uint64, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	var records []originRecord
+	for _, s := range self.segments {
+		for off := s.BaseOffset; off < s.NextOffset; off++ {
+			record, err := s.Read(off)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			if record.Origin == origin {
+				records = append(records, originRecord{
+					offset:       off,
+					originOffset: record.OriginOffset,
+					hash:         segment.HashRecord(record),
+				})
+			}
+		}
+	}
+
+	return records, self.activeSegment.NextOffset, nil
+}
+
+// replace removes the records from the offset onwards and appends
+// the records instead, unless the log grew past next in the meantime.
+func (self *Log) replace(offset, next uint64, records []*v1.Record) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.activeSegment.NextOffset != next {
+		return fmt.Errorf("records were appended from offset %d", next)
+	}
+
+	if err := self.rewind(offset); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if _, err := self.append(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
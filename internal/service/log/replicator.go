@@ -2,25 +2,59 @@ package logger
 
 import (
 	"context"
-	"fmt"
+	"log"
 	v1 "logger/gen/go/v1"
+	"logger/internal/domain"
+	"logger/internal/service/discovery"
+	"sort"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+// limits of the batches pulled from other servers
+const (
+	replicateMaxRecords = 512
+	replicateMaxBytes   = 1 << 20
+	replicateMaxWait    = 100 * time.Millisecond
+)
+
+// waits before following a server again after an error
+const (
+	replicateMinBackoff = 100 * time.Millisecond
+	replicateMaxBackoff = 10 * time.Second
+)
+
+var _ discovery.Handler = (*Replicator)(nil)
+
 // Replicator replicates log entries to other nodes in the cluster.
+// Each node is the source of the records it is the origin of, so the
+// records aren't replicated back and forth between the nodes.
 type Replicator struct {
 	DialOptions []grpc.DialOption
 	LocalServer v1.LogClient
+	// Log resumes the replication of a node after the records
+	// of the node it holds, from the start when nil
+	Log *Log
 
 	mu      sync.Mutex
 	servers map[string]chan struct{}
+	peers   map[string]*domain.Peer
 	closed  bool
 	close   chan struct{}
+
+	// held for reading while a batch is produced, see Pause
+	producing sync.RWMutex
 }
 
-func (self *Replicator) Join(name, addr string) error {
+// Join starts replicating from the node.
+func (self *Replicator) Join(node discovery.Node) error {
+	addr := node.RPCAddr
+
 	// lock mutex to prevent race conditions
 	self.mu.Lock()
 	defer self.mu.Unlock()
@@ -28,7 +62,7 @@ func (self *Replicator) Join(name, addr string) error {
 	// initialize channels
 	self.init()
 
-	if self.closed {
+	if self.closed || addr == "" {
 		return nil
 	}
 
@@ -40,18 +74,22 @@ func (self *Replicator) Join(name, addr string) error {
 
 	// add server to map
 	self.servers[addr] = make(chan struct{})
+	self.peers[addr] = &domain.Peer{Name: node.Name, Addr: addr}
 
-	go self.replicate(addr, self.servers[addr])
+	go self.replicate(addr, node.Name, self.servers[addr])
 
 	return nil
 }
 
-// Replicate replicates log entries to other nodes in the cluster.
-func (self *Replicator) replicate(addr string, leave chan struct{}) {
+// replicate replicates the records of the server until it leaves,
+// following the server again after errors.
+func (self *Replicator) replicate(addr, name string, leave chan struct{}) {
 	// Create grpc client that connects to server
 	cc, err := grpc.NewClient(addr, self.DialOptions...)
 	if err != nil {
 		self.err(err)
+		// let a later join start over
+		self.forget(addr, leave)
 		return
 	}
 	// Close client when done
@@ -60,58 +98,182 @@ func (self *Replicator) replicate(addr string, leave chan struct{}) {
 	// Create client to get stream from server
 	client := v1.NewLogClient(cc)
 
-	ctx := context.Background()
+	backoff := replicateMinBackoff
+	for {
+		progressed, err := self.follow(client, addr, name, leave)
+		if err == nil {
+			return
+		}
+		self.err(err)
+
+		if progressed {
+			backoff = replicateMinBackoff
+		}
+
+		select {
+		case <-self.close:
+			return
+		case <-leave:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, replicateMaxBackoff)
+	}
+}
+
+// follow produces the batches of the server until it leaves or
+// an error occurs, and reports whether a batch was produced.
+func (self *Replicator) follow(client v1.LogClient, addr, name string, leave chan struct{}) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the records of the node are at their origin offsets
+	var offset uint64
+	if self.Log != nil {
+		offset = self.Log.NextOriginOffset(name)
+	}
 
-	// Get stream from server
-	stream, err := client.ConsumeStream(
+	// Get stream of record batches from server
+	stream, err := client.ConsumeBatchStream(
 		ctx,
 		&v1.ConsumeRequest{
-			Offset: 0,
+			Offset:     offset,
+			MaxRecords: replicateMaxRecords,
+			MaxBytes:   replicateMaxBytes,
+			MaxWait:    durationpb.New(replicateMaxWait),
 		},
 	)
 	if err != nil {
-		self.err(err)
-		return
+		return false, err
 	}
 
-	// Get records from the stream
-	records := make(chan *v1.Record)
+	// Get batches from the stream
+	batches := make(chan []*v1.Record)
+	errs := make(chan error, 1)
 	go func() {
 		for {
 			recv, err := stream.Recv()
 			if err != nil {
-				self.err(err)
+				errs <- err
 				return
 			}
 
-			records <- recv.Record
+			select {
+			case batches <- recv.Records:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
 	// Send records to the server
+	var progressed bool
 	for {
 		select {
 		case <-self.close:
-			return
+			return progressed, nil
 		case <-leave:
-			return
-		case record := <-records:
+			return progressed, nil
+		case err := <-errs:
+			return progressed, err
+		case batch := <-batches:
+			err := self.produce(ctx, addr, name, batch)
+			if err != nil {
+				return progressed, err
+			}
+			progressed = true
+		}
+	}
+}
+
+// produce appends the records of a batch the server is the origin of
+// to the local log.
+func (self *Replicator) produce(ctx context.Context, addr, name string, batch []*v1.Record) error {
+	self.producing.RLock()
+	defer self.producing.RUnlock()
+
+	for _, record := range batch {
+		// the local log assigns its own offset
+		off := record.Offset
+
+		// the records of a log that doesn't keep origins are its own
+		if record.Origin == "" {
+			record.Origin = name
+			record.OriginOffset = off
+		}
+
+		if record.Origin == name {
 			_, err := self.LocalServer.Produce(
 				ctx,
 				&v1.ProduceRequest{
 					Record: record,
 				},
 			)
-			if err != nil {
-				self.err(err)
-				return
+			// the record was replicated before
+			if err != nil && status.Code(err) != codes.AlreadyExists {
+				return err
 			}
 		}
+
+		self.progress(addr, off+1)
+	}
+
+	return nil
+}
+
+// Pause holds off the replication until the returned function
+// is called, once the batches being produced are appended.
+func (self *Replicator) Pause() func() {
+	self.producing.Lock()
+	return self.producing.Unlock
+}
+
+// progress stores the next offset to be replicated from the server.
+func (self *Replicator) progress(addr string, next uint64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if p, ok := self.peers[addr]; ok {
+		p.NextOffset = next
+	}
+}
+
+// forget removes the server unless it left and joined again.
+func (self *Replicator) forget(addr string, leave chan struct{}) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.servers[addr] != leave {
+		return
 	}
+
+	delete(self.servers, addr)
+	delete(self.peers, addr)
+}
+
+// Peers returns the replication state of every server.
+func (self *Replicator) Peers() []domain.Peer {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	peers := make([]domain.Peer, 0, len(self.peers))
+	for _, p := range self.peers {
+		peers = append(peers, *p)
+	}
+
+	// sort the peers for the sake of determinism
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Name < peers[j].Name
+	})
+
+	return peers
 }
 
 // Leave removes the server from the map.
-func (self *Replicator) Leave(name, addr string) error {
+func (self *Replicator) Leave(node discovery.Node) error {
+	addr := node.RPCAddr
+
 	self.mu.Lock()
 	defer self.mu.Unlock()
 
@@ -124,6 +286,7 @@ func (self *Replicator) Leave(name, addr string) error {
 
 	close(self.servers[addr])
 	delete(self.servers, addr)
+	delete(self.peers, addr)
 
 	return nil
 }
@@ -134,6 +297,10 @@ func (self *Replicator) init() {
 		self.servers = make(map[string]chan struct{})
 	}
 
+	if self.peers == nil {
+		self.peers = make(map[string]*domain.Peer)
+	}
+
 	if self.close == nil {
 		self.close = make(chan struct{})
 	}
@@ -158,5 +325,5 @@ func (self *Replicator) Close() error {
 
 // Print log
 func (self *Replicator) err(err error) {
-	fmt.Printf("[ERROR] golog: %v\n", err)
+	log.Printf("[ERROR] golog: %v", err)
 }
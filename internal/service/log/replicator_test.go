@@ -0,0 +1,322 @@
+package logger_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/authn"
+	"logger/internal/service/config"
+	"logger/internal/service/discovery"
+	logger "logger/internal/service/log"
+	"logger/internal/transport/rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authority signs the certificates of a generation.
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &authority{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue writes a key pair signed by the authority and its CA to the files.
+func (self *authority) issue(t *testing.T, cn string, files config.TLSConfig) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, self.cert, &key.PublicKey, self.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files are modified later than the last load
+	modTime := time.Now().Add(time.Minute)
+	for path, p := range map[string][]byte{
+		files.CertFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		files.KeyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		files.CAFile:   self.pem,
+	} {
+		if err := os.WriteFile(path, p, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func tlsFiles(dir, name string) config.TLSConfig {
+	return config.TLSConfig{
+		CertFile: filepath.Join(dir, name+".pem"),
+		KeyFile:  filepath.Join(dir, name+"-key.pem"),
+		CAFile:   filepath.Join(dir, name+"-ca.pem"),
+	}
+}
+
+// allow lets every subject do everything.
+type allow struct{}
+
+func (allow) Authorize(subject, object, action string) error { return nil }
+
+// localServer records the records produced by the replicator.
+type localServer struct {
+	v1.LogClient
+
+	mu      sync.Mutex
+	records []*v1.Record
+	// fail is the number of calls rejected first, like a draining node
+	fail int
+}
+
+func (self *localServer) Produce(
+	ctx context.Context,
+	req *v1.ProduceRequest,
+	opts ...grpc.CallOption,
+) (*v1.ProduceResponse, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.fail > 0 {
+		self.fail--
+		return nil, status.Error(codes.Unavailable, "node is draining")
+	}
+
+	self.records = append(self.records, req.Record)
+	return &v1.ProduceResponse{Offset: uint64(len(self.records) - 1)}, nil
+}
+
+// wait waits for the number of records to be produced.
+func (self *localServer) wait(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		self.mu.Lock()
+		got := len(self.records)
+		self.mu.Unlock()
+
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d records, want %d", got, n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (self *localServer) reset() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.records = nil
+}
+
+func TestReplicatorPicksUpRotatedCertificates(t *testing.T) {
+	dir := t.TempDir()
+	serverFiles := tlsFiles(dir, "server")
+	clientFiles := tlsFiles(dir, "client")
+
+	ca := newAuthority(t, "ca-1")
+	ca.issue(t, "server", serverFiles)
+	ca.issue(t, "replicator", clientFiles)
+
+	// a client holding on to the certificates before the rotation
+	staleFiles := tlsFiles(t.TempDir(), "stale")
+	ca.issue(t, "replicator", staleFiles)
+
+	serverFiles.Server = true
+	serverTLS, err := config.SetupTLSConfig(serverFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no ServerAddress, the server is verified against the dialed host
+	clientTLS, err := config.SetupTLSConfig(clientFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleTLS, err := config.SetupTLSConfig(staleFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := logger.New(t.TempDir(), &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	server, err := rpc.New(&rpc.Config{
+		CommitLog:      log,
+		Authorize:      allow{},
+		Authenticators: []authn.Authenticator{authn.MTLS{}},
+	}, grpc.Creds(credentials.NewTLS(serverTLS)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	defer server.Stop()
+
+	local := &localServer{}
+	replicator := &logger.Replicator{
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(clientTLS))},
+		LocalServer: local,
+	}
+	defer replicator.Close()
+
+	source := discovery.Node{Name: "source", RPCAddr: ln.Addr().String()}
+	if err := replicator.Join(source); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Append(&v1.Record{Value: []byte("before")})
+	local.wait(t, 1)
+
+	// rotate every certificate to a new authority
+	// and let the watchers see the change
+	rotated := newAuthority(t, "ca-2")
+	rotated.issue(t, "server", serverFiles)
+	rotated.issue(t, "replicator", clientFiles)
+	time.Sleep(1100 * time.Millisecond)
+
+	// the open stream keeps replicating
+	log.Append(&v1.Record{Value: []byte("after")})
+	local.wait(t, 2)
+
+	// new connections are made with the rotated certificates
+	var p peer.Peer
+	cc, err := grpc.NewClient(source.RPCAddr, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = v1.NewLogClient(cc).Consume(ctx, &v1.ConsumeRequest{Offset: 0}, grpc.Peer(&p))
+	if err != nil {
+		t.Fatalf("consume with the rotated certificates: %s", err)
+	}
+	issuer := p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0].Issuer.CommonName
+	if issuer != "ca-2" {
+		t.Fatalf("server presented a certificate of %s, want ca-2", issuer)
+	}
+
+	// the certificates of the old authority are rejected
+	stale, err := grpc.NewClient(source.RPCAddr, grpc.WithTransportCredentials(credentials.NewTLS(staleTLS)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stale.Close()
+
+	_, err = v1.NewLogClient(stale).Consume(ctx, &v1.ConsumeRequest{Offset: 0})
+	if err == nil {
+		t.Fatal("consume with the certificates of the old authority")
+	}
+
+	// the replicator connects again with the rotated certificates
+	replicator.Leave(source)
+	local.reset()
+	if err := replicator.Join(source); err != nil {
+		t.Fatal(err)
+	}
+	local.wait(t, 2)
+}
+
+func TestReplicatorRetriesAfterProduceErrors(t *testing.T) {
+	source := openLog(t, "source")
+	addr := servePeer(t, source, allow{})
+
+	local := &localServer{fail: 2}
+	replicator := &logger.Replicator{
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		LocalServer: local,
+	}
+	defer replicator.Close()
+
+	node := discovery.Node{Name: "source", RPCAddr: addr}
+	if err := replicator.Join(node); err != nil {
+		t.Fatal(err)
+	}
+
+	produce(t, source, "orders", "0", "1", "2")
+	// the rejected batch is produced again
+	local.wait(t, 3)
+	if got := replicator.Peers()[0].NextOffset; got != 3 {
+		t.Fatalf("got next offset %d, want 3", got)
+	}
+}
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"log"
+	"time"
+)
+
+// Retention bounds the log, a zero limit is not enforced.
+// Only whole sealed segments are removed, so the log may keep
+// more records than MaxRecords and records older than MaxAge.
+type Retention struct {
+	// MaxAge of the segments kept, from their last append
+	MaxAge time.Duration
+	// MaxRecords kept
+	MaxRecords uint64
+}
+
+// SetRetention changes the limits enforced from the next check on.
+func (self *Log) SetRetention(retention Retention) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.retention = retention
+}
+
+// RetainEvery enforces the retention on every interval
+// until the log is closed.
+func (self *Log) RetainEvery(interval time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.stopRetention != nil {
+		return
+	}
+	stop := make(chan struct{})
+	self.stopRetention = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := self.Retain(time.Now()); err != nil {
+					log.Printf("[ERROR] golog: failed to truncate log: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// Retain removes the sealed segments beyond the retention limits.
+func (self *Log) Retain(now time.Time) error {
+	lowest, keep, err := self.retained(now)
+	if err != nil || keep == lowest {
+		return err
+	}
+
+	// whole segments below the first kept record are removed
+	return self.Truncate(keep)
+}
+
+// retained returns the lowest offset and the first offset to keep.
+func (self *Log) retained(now time.Time) (uint64, uint64, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	retention := self.retention
+	lowest := self.segments[0].BaseOffset
+	next := self.activeSegment.NextOffset
+
+	keep := lowest
+	if max := retention.MaxRecords; max > 0 && next-lowest > max {
+		keep = next - max
+	}
+
+	if retention.MaxAge > 0 {
+		expired := now.Add(-retention.MaxAge)
+
+		// the segments are appended to in offset order
+		for _, s := range self.segments {
+			if s == self.activeSegment {
+				break
+			}
+
+			fi, err := s.Store.Stat()
+			if err != nil {
+				return 0, 0, err
+			}
+			if fi.ModTime().After(expired) {
+				break
+			}
+
+			if s.NextOffset > keep {
+				keep = s.NextOffset
+			}
+		}
+	}
+
+	return lowest, keep, nil
+}
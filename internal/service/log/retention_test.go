@@ -0,0 +1,179 @@
+package logger_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/config"
+	logger "logger/internal/service/log"
+)
+
+// appendRecords appends n records and returns the offset of the last one.
+func appendRecords(t *testing.T, l *logger.Log, n int) uint64 {
+	t.Helper()
+
+	var off uint64
+	for i := 0; i < n; i++ {
+		var err error
+		off, err = l.Append(&v1.Record{Value: []byte(fmt.Sprintf("record-%d", i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return off
+}
+
+func TestReopenWithALowerIndexLimit(t *testing.T) {
+	dir := t.TempDir()
+
+	// 8 entries of 12 bytes in one segment
+	l, err := logger.New(dir, &config.Config{Segment: config.Segment{MaxIndexBytes: 120}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, 8)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit is lowered below the entries already written
+	l, err = logger.New(dir, &config.Config{Segment: config.Segment{MaxIndexBytes: 36}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for off := uint64(0); off < 8; off++ {
+		record, err := l.Read(off)
+		if err != nil {
+			t.Fatalf("read %d: %s", off, err)
+		}
+		if want := fmt.Sprintf("record-%d", off); string(record.Value) != want {
+			t.Fatalf("read %d: got %q, want %q", off, record.Value, want)
+		}
+	}
+	if _, err := l.Read(8); err == nil {
+		t.Fatal("read past the end of the log")
+	}
+
+	// the full segment is sealed, the appends go to a new one
+	off, err := l.Append(&v1.Record{Value: []byte("record-8")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off != 8 {
+		t.Fatalf("got offset %d, want 8", off)
+	}
+	if segments := l.Segments(); len(segments) != 2 || segments[1].BaseOffset != 8 {
+		t.Fatalf("got segments %+v, want a new one at 8", segments)
+	}
+}
+
+func TestRetainMaxRecords(t *testing.T) {
+	// 3 records per segment
+	l, err := logger.New(t.TempDir(), &config.Config{Segment: config.Segment{MaxIndexBytes: 36}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	appendRecords(t, l, 10)
+
+	// nothing is removed without limits
+	if err := l.Retain(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if lowest, _ := l.LowestOffset(); lowest != 0 {
+		t.Fatalf("got lowest offset %d, want 0", lowest)
+	}
+
+	// offsets 5 to 9 are kept, the segment of 3 to 5 holds 5
+	l.SetRetention(logger.Retention{MaxRecords: 5})
+	if err := l.Retain(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if lowest, _ := l.LowestOffset(); lowest != 3 {
+		t.Fatalf("got lowest offset %d, want 3", lowest)
+	}
+}
+
+func TestRetainMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	l, err := logger.New(dir, &config.Config{Segment: config.Segment{MaxIndexBytes: 36}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	appendRecords(t, l, 7)
+
+	// the segments at 0 and 3 were last appended to an hour ago,
+	// the active one at 6 is always kept
+	now := time.Now()
+	for _, base := range []uint64{0, 3} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.store", base))
+		if err := os.Chtimes(path, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "6.store")
+	if err := os.Chtimes(path, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	l.SetRetention(logger.Retention{MaxAge: 2 * time.Hour})
+	if err := l.Retain(now); err != nil {
+		t.Fatal(err)
+	}
+	if lowest, _ := l.LowestOffset(); lowest != 0 {
+		t.Fatalf("got lowest offset %d, want 0", lowest)
+	}
+
+	l.SetRetention(logger.Retention{MaxAge: time.Minute})
+	if err := l.Retain(now); err != nil {
+		t.Fatal(err)
+	}
+	if lowest, _ := l.LowestOffset(); lowest != 6 {
+		t.Fatalf("got lowest offset %d, want 6", lowest)
+	}
+	if _, err := l.Read(6); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTruncateKeepsTheLowestOffset(t *testing.T) {
+	// 3 records per segment
+	l, err := logger.New(t.TempDir(), &config.Config{Segment: config.Segment{MaxIndexBytes: 36}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	appendRecords(t, l, 7)
+
+	// the segment at 0 holds offset 2, it's kept
+	if err := l.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if lowest, _ := l.LowestOffset(); lowest != 0 {
+		t.Fatalf("got lowest offset %d, want 0", lowest)
+	}
+	if _, err := l.Read(2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the segment at 3 starts with the lowest offset
+	if err := l.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if lowest, _ := l.LowestOffset(); lowest != 3 {
+		t.Fatalf("got lowest offset %d, want 3", lowest)
+	}
+	if _, err := l.Read(3); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,177 @@
+package logger
+
+import (
+	"encoding/json"
+	"log"
+	v1 "logger/gen/go/v1"
+	"logger/internal/domain"
+	"logger/internal/service/auth"
+	"logger/internal/service/segment"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+Topics are created implicitly by the records produced to them.
+Creating a topic explicitly registers it, so it's listed, and
+deleting it rejects the records produced to it from then on.
+The records already produced stay until the retention removes them.
+
+Each create or delete is a record of the __topics topic, so the
+followers learn about it by replicating the log like any record.
+The log rebuilds the topics from these records when it is opened,
+from its checkpoint on, see checkpoint.go, and keeps them up to date
+as they are appended. Truncate doesn't lose them: a topic whose last
+change is in a removed segment is written again as a single restore
+record holding its state.
+*/
+
+// TopicsTopic is the topic of the records creating and deleting topics
+const TopicsTopic = "__topics"
+
+const (
+	topicCreate  = "create"
+	topicDelete  = "delete"
+	topicRestore = "restore"
+)
+
+// topicChange creates, deletes or restores a topic.
+type topicChange struct {
+	Op    string `json:"op"`
+	Topic string `json:"topic"`
+	// State of the restored topic
+	State *domain.Topic `json:"state,omitempty"`
+}
+
+// topicState is a topic and the offset of its last change.
+type topicState struct {
+	domain.Topic
+	offset uint64
+}
+
+// CreateTopic registers a topic, it returns the offset of the change.
+func (self *Log) CreateTopic(name string) (uint64, error) {
+	return self.changeTopic(topicChange{Op: topicCreate, Topic: name})
+}
+
+// DeleteTopic deletes a created topic, it returns the offset of the change.
+func (self *Log) DeleteTopic(name string) (uint64, error) {
+	return self.changeTopic(topicChange{Op: topicDelete, Topic: name})
+}
+
+// Topics returns the created topics, deleted ones included.
+func (self *Log) Topics() ([]domain.Topic, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	topics := make([]domain.Topic, 0, len(self.topics))
+	for _, t := range self.topics {
+		topics = append(topics, t.Topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Name < topics[j].Name
+	})
+
+	return topics, nil
+}
+
+// TopicDeleted reports whether the topic was deleted and not created again.
+func (self *Log) TopicDeleted(name string) (bool, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	t, ok := self.topics[name]
+	return ok && t.Deleted, nil
+}
+
+// changeTopic checks the change against the topics and appends it.
+func (self *Log) changeTopic(change topicChange) (uint64, error) {
+	if change.Topic == "" {
+		return 0, status.Error(codes.InvalidArgument, "empty topic")
+	}
+	if auth.IsSystemTopic(change.Topic) {
+		return 0, status.Errorf(codes.InvalidArgument, "topic %q is reserved", change.Topic)
+	}
+
+	value, err := json.Marshal(change)
+	if err != nil {
+		return 0, err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	t, ok := self.topics[change.Topic]
+	exists := ok && !t.Deleted
+	if change.Op == topicCreate && exists {
+		return 0, status.Errorf(codes.AlreadyExists, "topic %q exists", change.Topic)
+	}
+	if change.Op == topicDelete && !exists {
+		return 0, status.Errorf(codes.NotFound, "topic %q not found", change.Topic)
+	}
+
+	return self.append(&v1.Record{Topic: TopicsTopic, Value: value})
+}
+
+// restoreTopics appends again the topics whose last change is
+// in one of the segments about to be removed, the lock must be held.
+func (self *Log) restoreTopics(removed []*segment.Segment) error {
+	var names []string
+	for name, t := range self.topics {
+		for _, s := range removed {
+			if s.BaseOffset <= t.offset && t.offset < s.NextOffset {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	// restored in the same order on every node
+	sort.Strings(names)
+
+	for _, name := range names {
+		state := self.topics[name].Topic
+		value, err := json.Marshal(topicChange{Op: topicRestore, Topic: name, State: &state})
+		if err != nil {
+			return err
+		}
+
+		if _, err := self.append(&v1.Record{Topic: TopicsTopic, Value: value}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyTopic applies the change of a record to the loaded topics,
+// the lock must be held.
+func (self *Log) applyTopic(record *v1.Record) {
+	var change topicChange
+	if err := json.Unmarshal(record.Value, &change); err != nil {
+		log.Printf("[ERROR] golog: invalid topic change at offset %d: %s", record.Offset, err)
+		return
+	}
+
+	switch change.Op {
+	case topicCreate:
+		self.topics[change.Topic] = &topicState{
+			Topic: domain.Topic{
+				Name:      change.Topic,
+				CreatedAt: record.Offset,
+			},
+			offset: record.Offset,
+		}
+	case topicDelete:
+		if t, ok := self.topics[change.Topic]; ok {
+			t.Deleted = true
+			t.DeletedAt = record.Offset
+			t.offset = record.Offset
+		}
+	case topicRestore:
+		if change.State != nil {
+			self.topics[change.Topic] = &topicState{Topic: *change.State, offset: record.Offset}
+		}
+	}
+}
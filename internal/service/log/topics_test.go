@@ -0,0 +1,74 @@
+package logger_test
+
+import (
+	"testing"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/domain"
+	"logger/internal/service/config"
+	logger "logger/internal/service/log"
+)
+
+func TestTopicsOutliveTruncation(t *testing.T) {
+	dir := t.TempDir()
+	c := &config.Config{}
+
+	l, err := logger.New(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"orders", "payments"} {
+		if _, err := l.CreateTopic(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deletedAt, err := l.DeleteTopic("payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// move the changes out of the active segment and drop them
+	if _, err := l.Roll(); err != nil {
+		t.Fatal(err)
+	}
+	off, err := l.Append(&v1.Record{Topic: "orders", Value: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Truncate(off); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Read(0); err == nil {
+		t.Fatal("the changes were not truncated")
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = logger.New(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	topics, err := l.Topics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.Topic{
+		{Name: "orders", CreatedAt: 0},
+		{Name: "payments", CreatedAt: 1, Deleted: true, DeletedAt: deletedAt},
+	}
+	if len(topics) != len(want) || topics[0] != want[0] || topics[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", topics, want)
+	}
+
+	deleted, err := l.TopicDeleted("payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Fatal("a deleted topic came back after the truncation")
+	}
+}
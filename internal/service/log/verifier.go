@@ -0,0 +1,325 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/discovery"
+	"logger/internal/service/segment"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+var _ discovery.Handler = (*Verifier)(nil)
+
+// Verifier compares the records each node of the cluster is the origin
+// of with their copies in the local log and reports the first divergent
+// offset, see origins.go.
+type Verifier struct {
+	DialOptions []grpc.DialOption
+	Log         *Log
+	// Interval of the background verification, zero disables it
+	Interval time.Duration
+	// Repair fetches the divergent records again
+	// during the background verification
+	Repair bool
+	// Replicator is held off while the records are repaired
+	Replicator *Replicator
+
+	mu     sync.Mutex
+	peers  map[string]string
+	closed bool
+	close  chan struct{}
+}
+
+// Join adds the node to the verified peers.
+func (self *Verifier) Join(node discovery.Node) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.init()
+
+	if self.closed || node.RPCAddr == "" {
+		return nil
+	}
+
+	self.peers[node.RPCAddr] = node.Name
+
+	return nil
+}
+
+// Leave removes the node from the verified peers.
+func (self *Verifier) Leave(node discovery.Node) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.init()
+
+	delete(self.peers, node.RPCAddr)
+
+	return nil
+}
+
+// Verify compares the local log with the peer at addr,
+// or with every known peer when addr is empty.
+func (self *Verifier) Verify(ctx context.Context, addr string, repair bool) []*v1.Verification {
+	addrs := []string{addr}
+	if addr == "" {
+		addrs = self.addrs()
+	}
+
+	var verifications []*v1.Verification
+	for _, addr := range addrs {
+		v, err := self.verify(ctx, addr, repair)
+		if err != nil {
+			v.Error = err.Error()
+		}
+		verifications = append(verifications, v)
+	}
+
+	return verifications
+}
+
+// verify compares the records the peer is the origin of
+// with their copies in the local log.
+func (self *Verifier) verify(ctx context.Context, addr string, repair bool) (*v1.Verification, error) {
+	v := &v1.Verification{RpcAddr: addr, Consistent: true}
+
+	cc, err := grpc.NewClient(addr, self.DialOptions...)
+	if err != nil {
+		return v, err
+	}
+	defer cc.Close()
+
+	client := v1.NewLogClient(cc)
+
+	// an empty range returns the origin and offsets of the peer
+	peer, err := client.Checksum(ctx, &v1.ChecksumRequest{Own: true})
+	if err != nil {
+		return v, err
+	}
+
+	records, _, err := self.Log.originRecords(peer.Origin)
+	if err != nil {
+		return v, err
+	}
+	if len(records) == 0 {
+		return v, nil
+	}
+
+	// compare only the range both logs hold
+	v.StartOffset = max(records[0].originOffset, peer.LowestOffset)
+	v.EndOffset = min(records[len(records)-1].originOffset+1, peer.NextOffset)
+	if v.StartOffset >= v.EndOffset {
+		return v, nil
+	}
+
+	equal, err := self.equal(ctx, client, records, v.StartOffset, v.EndOffset)
+	if err != nil || equal {
+		return v, err
+	}
+
+	// binary search the first divergent offset,
+	// the prefix up to a is equal and up to b is not
+	a, b := v.StartOffset, v.EndOffset
+	for b-a > 1 {
+		m := a + (b-a)/2
+		equal, err := self.equal(ctx, client, records, v.StartOffset, m)
+		if err != nil {
+			return v, err
+		}
+
+		if equal {
+			a = m
+		} else {
+			b = m
+		}
+	}
+
+	v.Consistent = false
+	v.FirstDivergentOffset = a
+
+	if !repair {
+		return v, nil
+	}
+
+	err = self.repair(ctx, client, peer.Origin, a)
+	if err != nil {
+		return v, err
+	}
+	v.Repaired = true
+
+	return v, nil
+}
+
+// equal compares the checksums of the records of the peer
+// in the range [start, end) of its offsets.
+func (self *Verifier) equal(
+	ctx context.Context,
+	client v1.LogClient,
+	records []originRecord,
+	start, end uint64,
+) (bool, error) {
+	var sum, count uint64
+	for _, r := range records {
+		if start <= r.originOffset && r.originOffset < end {
+			sum, count = segment.CombineChecksums(sum, count, r.hash, 1)
+		}
+	}
+
+	res, err := client.Checksum(ctx, &v1.ChecksumRequest{
+		StartOffset: start,
+		EndOffset:   end,
+		Own:         true,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return sum == res.Checksum && count == res.Count, nil
+}
+
+// repair replaces the local copies of the records of the peer from
+// its offset onwards with the ones it holds. The records are fetched
+// before the log is touched, and the repair is refused when records
+// the peer doesn't hold would be removed: records of other origins
+// appended after the divergent one, or records the peer lost.
+func (self *Verifier) repair(
+	ctx context.Context,
+	client v1.LogClient,
+	origin string,
+	offset uint64,
+) error {
+	if self.Replicator != nil {
+		defer self.Replicator.Pause()()
+	}
+
+	records, next, err := self.Log.originRecords(origin)
+	if err != nil {
+		return err
+	}
+
+	i := sort.Search(len(records), func(i int) bool {
+		return records[i].originOffset >= offset
+	})
+	if i == len(records) {
+		return nil
+	}
+	from := records[i].offset
+
+	// every record from the first divergent one is a copy of the peer
+	if next-from != uint64(len(records)-i) {
+		return fmt.Errorf(
+			"refusing to repair: records of other origins follow offset %d",
+			from,
+		)
+	}
+
+	peer, err := client.Checksum(ctx, &v1.ChecksumRequest{Own: true})
+	if err != nil {
+		return err
+	}
+	if last := records[len(records)-1].originOffset; last >= peer.NextOffset {
+		return fmt.Errorf(
+			"refusing to repair: records from offset %d are missing from the peer",
+			peer.NextOffset,
+		)
+	}
+
+	var fetched []*v1.Record
+	for off := offset; off < peer.NextOffset; off++ {
+		res, err := client.Consume(ctx, &v1.ConsumeRequest{Offset: off})
+		if err != nil {
+			return err
+		}
+
+		if res.Record.Origin == origin {
+			fetched = append(fetched, res.Record)
+		}
+	}
+
+	return self.Log.replace(from, next, fetched)
+}
+
+// run verifies every peer until the verifier is closed.
+func (self *Verifier) run() {
+	ticker := time.NewTicker(self.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-self.close:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), self.Interval)
+			for _, v := range self.Verify(ctx, "", self.Repair) {
+				self.report(v)
+			}
+			cancel()
+		}
+	}
+}
+
+// report prints the result of a verification.
+func (self *Verifier) report(v *v1.Verification) {
+	switch {
+	case v.Error != "":
+		log.Printf("[ERROR] golog: failed to verify %s: %s", v.RpcAddr, v.Error)
+	case !v.Consistent:
+		log.Printf(
+			"[WARN] golog: log diverges from %s at offset %d (repaired: %t)",
+			v.RpcAddr,
+			v.FirstDivergentOffset,
+			v.Repaired,
+		)
+	}
+}
+
+// addrs returns the addresses of the known peers.
+func (self *Verifier) addrs() []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	addrs := make([]string, 0, len(self.peers))
+	for addr := range self.peers {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	return addrs
+}
+
+// init initializes channels and starts the background verification.
+func (self *Verifier) init() {
+	if self.peers == nil {
+		self.peers = make(map[string]string)
+	}
+
+	if self.close == nil {
+		self.close = make(chan struct{})
+		if self.Interval > 0 {
+			go self.run()
+		}
+	}
+}
+
+// Close stops the background verification.
+func (self *Verifier) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.init()
+
+	if self.closed {
+		return nil
+	}
+
+	self.closed = true
+	close(self.close)
+
+	return nil
+}
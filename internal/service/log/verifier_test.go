@@ -0,0 +1,272 @@
+package logger_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/authn"
+	"logger/internal/service/config"
+	logger "logger/internal/service/log"
+	"logger/internal/transport/rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// anonymous authenticates every call as root.
+type anonymous struct{}
+
+func (anonymous) Authenticate(ctx context.Context) (string, error) { return "root", nil }
+
+// denyTopic lets every subject do everything but read a topic.
+type denyTopic string
+
+func (self denyTopic) Authorize(subject, object, action string) error {
+	if object == "topic/"+string(self) {
+		return status.Errorf(codes.PermissionDenied, "%s can't %s %s", subject, action, object)
+	}
+	return nil
+}
+
+func openLog(t *testing.T, node string) *logger.Log {
+	t.Helper()
+
+	l, err := logger.New(t.TempDir(), &config.Config{NodeName: node})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	return l
+}
+
+// servePeer serves the log of a peer and returns its address.
+func servePeer(t *testing.T, l *logger.Log, authorizer rpc.Authorizer) string {
+	t.Helper()
+
+	server, err := rpc.New(&rpc.Config{
+		CommitLog:      l,
+		Authorize:      authorizer,
+		Authenticators: []authn.Authenticator{anonymous{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	return ln.Addr().String()
+}
+
+// produce appends records produced to the node, one per value.
+func produce(t *testing.T, l *logger.Log, topic string, values ...string) {
+	t.Helper()
+
+	for _, v := range values {
+		if _, err := l.Append(&v1.Record{Topic: topic, Value: []byte(v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// replicate appends copies of the records of the peer from the offset,
+// the values given replace the ones of the peer.
+func replicate(t *testing.T, l, peer *logger.Log, from, to uint64, values map[uint64]string) {
+	t.Helper()
+
+	for off := from; off < to; off++ {
+		record, err := peer.Read(off)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		copy := &v1.Record{
+			Topic:        record.Topic,
+			Value:        record.Value,
+			Origin:       record.Origin,
+			OriginOffset: record.OriginOffset,
+		}
+		if v, ok := values[off]; ok {
+			copy.Value = []byte(v)
+		}
+
+		if _, err := l.Append(copy); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// values returns the topic and value of every record of the log.
+func values(t *testing.T, l *logger.Log) string {
+	t.Helper()
+
+	var got []string
+	for off := uint64(0); ; off++ {
+		record, err := l.Read(off)
+		if err != nil {
+			return fmt.Sprint(got)
+		}
+		got = append(got, record.Origin+":"+string(record.Value))
+	}
+}
+
+func verify(t *testing.T, local *logger.Log, addr string, repair bool) *v1.Verification {
+	t.Helper()
+
+	verifier := &logger.Verifier{
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		Log:         local,
+	}
+	defer verifier.Close()
+
+	vs := verifier.Verify(context.Background(), addr, repair)
+	if len(vs) != 1 {
+		t.Fatalf("got %d verifications, want 1", len(vs))
+	}
+
+	return vs[0]
+}
+
+func TestVerifierComparesRecordsByOrigin(t *testing.T) {
+	peer := openLog(t, "node-b")
+	produce(t, peer, "orders", "b0", "b1", "b2", "b3")
+	addr := servePeer(t, peer, allow{})
+
+	// both nodes take writes, so the offsets of the copies differ
+	local := openLog(t, "node-a")
+	produce(t, local, "orders", "a0", "a1", "a2")
+	replicate(t, local, peer, 0, 4, nil)
+
+	v := verify(t, local, addr, false)
+	if v.Error != "" || !v.Consistent {
+		t.Fatalf("got %+v, want consistent", v)
+	}
+	if v.StartOffset != 0 || v.EndOffset != 4 {
+		t.Fatalf("compared [%d, %d), want [0, 4)", v.StartOffset, v.EndOffset)
+	}
+}
+
+func TestVerifierKeepsRecordsThePeerLacks(t *testing.T) {
+	peer := openLog(t, "node-b")
+	produce(t, peer, "orders", "b0", "b1", "b2", "b3")
+	addr := servePeer(t, peer, allow{})
+
+	// the records produced to the node are never compared with the peer
+	local := openLog(t, "node-a")
+	produce(t, local, "orders", "a0", "a1", "a2")
+	before := values(t, local)
+
+	v := verify(t, local, addr, true)
+	if v.Error != "" || !v.Consistent || v.Repaired {
+		t.Fatalf("got %+v, want consistent", v)
+	}
+	if got := values(t, local); got != before {
+		t.Fatalf("got %s, want %s", got, before)
+	}
+}
+
+func TestVerifierRepairsCopies(t *testing.T) {
+	peer := openLog(t, "node-b")
+	produce(t, peer, "orders", "b0", "b1", "b2", "b3")
+	addr := servePeer(t, peer, allow{})
+
+	local := openLog(t, "node-a")
+	produce(t, local, "orders", "a0")
+	replicate(t, local, peer, 0, 3, map[uint64]string{2: "corrupt"})
+
+	v := verify(t, local, addr, false)
+	if v.Consistent || v.FirstDivergentOffset != 2 {
+		t.Fatalf("got %+v, want divergent at 2", v)
+	}
+
+	v = verify(t, local, addr, true)
+	if v.Error != "" || !v.Repaired {
+		t.Fatalf("got %+v, want repaired", v)
+	}
+
+	// the copies are fetched up to the end of the peer
+	want := "[node-a:a0 node-b:b0 node-b:b1 node-b:b2 node-b:b3]"
+	if got := values(t, local); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if v := verify(t, local, addr, false); !v.Consistent {
+		t.Fatalf("got %+v after the repair, want consistent", v)
+	}
+
+	// the repaired records aren't replicated again
+	_, err := local.Append(&v1.Record{Value: []byte("b3"), Origin: "node-b", OriginOffset: 3})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("got %v, want AlreadyExists", err)
+	}
+}
+
+func TestVerifierRefusesToRemoveOtherRecords(t *testing.T) {
+	peer := openLog(t, "node-b")
+	produce(t, peer, "orders", "b0", "b1", "b2")
+	addr := servePeer(t, peer, allow{})
+
+	local := openLog(t, "node-a")
+	replicate(t, local, peer, 0, 2, map[uint64]string{1: "corrupt"})
+	produce(t, local, "orders", "a0")
+	before := values(t, local)
+
+	v := verify(t, local, addr, true)
+	if v.Error == "" || v.Repaired {
+		t.Fatalf("got %+v, want a refused repair", v)
+	}
+	if got := values(t, local); got != before {
+		t.Fatalf("got %s, want %s", got, before)
+	}
+}
+
+func TestVerifierRefusesToRemoveRecordsThePeerLost(t *testing.T) {
+	peer := openLog(t, "node-b")
+	produce(t, peer, "orders", "b0", "b1", "b2", "b3")
+	addr := servePeer(t, peer, allow{})
+
+	local := openLog(t, "node-a")
+	replicate(t, local, peer, 0, 4, map[uint64]string{1: "corrupt"})
+
+	// the peer lost its last records since
+	if err := peer.Rewind(2); err != nil {
+		t.Fatal(err)
+	}
+	before := values(t, local)
+
+	v := verify(t, local, addr, true)
+	if v.Error == "" || v.Repaired {
+		t.Fatalf("got %+v, want a refused repair", v)
+	}
+	if got := values(t, local); got != before {
+		t.Fatalf("got %s, want %s", got, before)
+	}
+}
+
+func TestVerifierLeavesTheLogOnFetchErrors(t *testing.T) {
+	peer := openLog(t, "node-b")
+	produce(t, peer, "orders", "b0", "b1")
+	produce(t, peer, "secret", "b2")
+	addr := servePeer(t, peer, denyTopic("secret"))
+
+	local := openLog(t, "node-a")
+	replicate(t, local, peer, 0, 3, map[uint64]string{1: "corrupt"})
+	before := values(t, local)
+
+	v := verify(t, local, addr, true)
+	if v.Error == "" || v.Repaired {
+		t.Fatalf("got %+v, want a failed repair", v)
+	}
+	if got := values(t, local); got != before {
+		t.Fatalf("got %s, want %s", got, before)
+	}
+}
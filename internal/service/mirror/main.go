@@ -0,0 +1,235 @@
+package mirror
+
+import (
+	"context"
+	"log"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/auth"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+/*
+This package implements the mirror service.
+It copies the records of selected topics from a source cluster
+to a target cluster, the same way the Replicator does inside a cluster:
+consume a batch from the source, then produce it to the target.
+Each side is dialed with its own TLS identity, so the target
+authorizes the mirror with its own casbin subject.
+*/
+
+// limits of the batches pulled from the source
+const (
+	mirrorMaxRecords = 512
+	mirrorMaxBytes   = 1 << 20
+	mirrorMaxWait    = 100 * time.Millisecond
+)
+
+// Config is used to configure the Mirror.
+type Config struct {
+	SourceAddr        string
+	SourceDialOptions []grpc.DialOption
+	TargetAddr        string
+	TargetDialOptions []grpc.DialOption
+	// Topics to mirror, every topic when empty
+	Topics []string
+	// Dir stores the offset translations
+	Dir string
+	// RetryInterval is the wait before reconnecting after an error
+	RetryInterval time.Duration
+}
+
+// Mirror copies records from a source cluster to a target cluster.
+type Mirror struct {
+	Config
+	Offsets *Offsets
+
+	topics map[string]struct{}
+	source v1.LogClient
+	target v1.LogClient
+	conns  []*grpc.ClientConn
+
+	mu     sync.Mutex
+	closed bool
+	close  chan struct{}
+	done   chan struct{}
+}
+
+// New creates a mirror and starts mirroring from the last checkpoint.
+func New(config Config) (*Mirror, error) {
+	if config.RetryInterval == 0 {
+		config.RetryInterval = time.Second
+	}
+
+	m := &Mirror{
+		Config: config,
+		close:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if len(config.Topics) > 0 {
+		m.topics = make(map[string]struct{}, len(config.Topics))
+		for _, t := range config.Topics {
+			m.topics[t] = struct{}{}
+		}
+	}
+
+	var err error
+	m.Offsets, err = OpenOffsets(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := grpc.NewClient(config.SourceAddr, config.SourceDialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	m.conns = append(m.conns, source)
+	m.source = v1.NewLogClient(source)
+
+	target, err := grpc.NewClient(config.TargetAddr, config.TargetDialOptions...)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	m.conns = append(m.conns, target)
+	m.target = v1.NewLogClient(target)
+
+	go m.run()
+
+	return m, nil
+}
+
+// run mirrors until the mirror is closed, reconnecting on errors.
+func (self *Mirror) run() {
+	defer close(self.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-self.close
+		cancel()
+	}()
+
+	for {
+		err := self.mirror(ctx)
+		if err != nil && ctx.Err() == nil {
+			self.err(err)
+		}
+
+		select {
+		case <-self.close:
+			return
+		case <-time.After(self.RetryInterval):
+		}
+	}
+}
+
+// mirror consumes batches from the source and produces the
+// allowed records to the target.
+func (self *Mirror) mirror(ctx context.Context) error {
+	stream, err := self.source.ConsumeBatchStream(
+		ctx,
+		&v1.ConsumeRequest{
+			Offset:     self.Offsets.Next(),
+			MaxRecords: mirrorMaxRecords,
+			MaxBytes:   mirrorMaxBytes,
+			MaxWait:    durationpb.New(mirrorMaxWait),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if len(res.Records) == 0 {
+			continue
+		}
+
+		for _, record := range res.Records {
+			if !self.allowed(record.Topic) {
+				continue
+			}
+
+			// the target assigns its own offset and origin
+			source := record.Offset
+			produced, err := self.target.Produce(
+				ctx,
+				&v1.ProduceRequest{Record: &v1.Record{
+					Topic: record.Topic,
+					Value: record.Value,
+				}},
+			)
+			if err != nil {
+				return err
+			}
+
+			err = self.Offsets.Add(source, produced.Offset)
+			if err != nil {
+				return err
+			}
+		}
+
+		next := res.Records[len(res.Records)-1].Offset + 1
+		err = self.Offsets.Commit(next)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// allowed reports whether the topic is mirrored,
+// system topics belong to their cluster.
+func (self *Mirror) allowed(topic string) bool {
+	if auth.IsSystemTopic(topic) {
+		return false
+	}
+
+	if self.topics == nil {
+		return true
+	}
+
+	_, ok := self.topics[topic]
+	return ok
+}
+
+// Translate returns the target offset of a mirrored source offset.
+func (self *Mirror) Translate(source uint64) (uint64, bool, error) {
+	return self.Offsets.Translate(source)
+}
+
+// Close stops mirroring and closes the connections.
+func (self *Mirror) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return nil
+	}
+
+	self.closed = true
+	close(self.close)
+	<-self.done
+
+	for _, cc := range self.conns {
+		if err := cc.Close(); err != nil {
+			return err
+		}
+	}
+
+	return self.Offsets.Close()
+}
+
+// Print log
+func (self *Mirror) err(err error) {
+	log.Printf("[ERROR] golog: mirror: %v", err)
+}
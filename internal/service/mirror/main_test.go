@@ -0,0 +1,146 @@
+package mirror_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/authn"
+	"logger/internal/service/config"
+	logger "logger/internal/service/log"
+	"logger/internal/service/mirror"
+	"logger/internal/transport/rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// anonymous authenticates every call as root.
+type anonymous struct{}
+
+func (anonymous) Authenticate(ctx context.Context) (string, error) { return "root", nil }
+
+// flaky denies the produce calls given once, counting from one.
+type flaky struct {
+	mu    sync.Mutex
+	calls int
+	fail  map[int]bool
+}
+
+func (self *flaky) Authorize(subject, object, action string) error {
+	if action != "produce" {
+		return nil
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.calls++
+	if self.fail[self.calls] {
+		return status.Errorf(codes.Unavailable, "produce %d failed", self.calls)
+	}
+	return nil
+}
+
+func (self *flaky) AuthorizeAny(subject, prefix, action string) error {
+	return nil
+}
+
+// serve serves a log and returns it with its address.
+func serve(t *testing.T, node string, authorizer rpc.Authorizer) (*logger.Log, string) {
+	t.Helper()
+
+	l, err := logger.New(t.TempDir(), &config.Config{NodeName: node})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	server, err := rpc.New(&rpc.Config{
+		CommitLog:      l,
+		Authorize:      authorizer,
+		Authenticators: []authn.Authenticator{anonymous{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	return l, ln.Addr().String()
+}
+
+func TestMirrorResumesAfterErrors(t *testing.T) {
+	source, sourceAddr := serve(t, "source", &flaky{})
+	// the third record of the batch fails once
+	target, targetAddr := serve(t, "target", &flaky{fail: map[int]bool{3: true}})
+
+	for _, r := range []*v1.Record{
+		{Topic: "orders", Value: []byte("0")},
+		{Topic: "secret", Value: []byte("1")},
+		{Topic: "orders", Value: []byte("2")},
+		{Topic: "orders", Value: []byte("3")},
+		{Topic: "orders", Value: []byte("4")},
+	} {
+		if _, err := source.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	creds := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	m, err := mirror.New(mirror.Config{
+		SourceAddr:        sourceAddr,
+		SourceDialOptions: creds,
+		TargetAddr:        targetAddr,
+		TargetDialOptions: creds,
+		Topics:            []string{"orders"},
+		Dir:               t.TempDir(),
+		RetryInterval:     10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// every record of the topic is mirrored once
+	want := []string{"0", "2", "3", "4"}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Offsets.Next() < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("mirrored up to %d, want 5", m.Offsets.Next())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// give a duplicate the time to show up
+	time.Sleep(50 * time.Millisecond)
+
+	for i, v := range want {
+		record, err := target.Read(uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(record.Value) != v || record.Origin != "target" {
+			t.Fatalf("got %s from %s at %d, want %s from target", record.Value, record.Origin, i, v)
+		}
+	}
+	if _, err := target.Read(uint64(len(want))); err == nil {
+		t.Fatal("got a duplicate record")
+	}
+
+	for source, target := range map[uint64]uint64{0: 0, 2: 1, 3: 2, 4: 3} {
+		got, ok, err := m.Translate(source)
+		if err != nil || !ok || got != target {
+			t.Fatalf("Translate(%d) = %d, %v, %v, want %d", source, got, ok, err, target)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package mirror
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	enc = binary.BigEndian
+)
+
+const (
+	offWidth = 8
+	entWidth = 2 * offWidth
+
+	translationsFile = "translations"
+	checkpointFile   = "checkpoint"
+)
+
+// Offsets stores the translation of source offsets to target offsets
+// and the next source offset to mirror, so the mirror resumes after restart.
+type Offsets struct {
+	mu   sync.Mutex
+	dir  string
+	file *os.File
+	size uint64
+	next uint64
+}
+
+// OpenOffsets opens the offsets stored in the directory.
+func OpenOffsets(dir string) (*Offsets, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(
+		filepath.Join(dir, translationsFile),
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Offsets{
+		dir:  dir,
+		file: file,
+		// drop a partially written entry
+		size: uint64(fi.Size()) / entWidth * entWidth,
+	}
+
+	err = file.Truncate(int64(o.size))
+	if err != nil {
+		return nil, err
+	}
+
+	o.next, err = o.readCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	// records translated after the last checkpoint
+	// were already mirrored
+	if o.size > 0 {
+		source, _, err := o.entry(o.size/entWidth - 1)
+		if err != nil {
+			return nil, err
+		}
+		o.next = max(o.next, source+1)
+	}
+
+	return o, nil
+}
+
+// Next returns the next source offset to mirror.
+func (self *Offsets) Next() uint64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.next
+}
+
+// Add stores the target offset of a mirrored source offset,
+// the mirror resumes after it even before the next commit.
+func (self *Offsets) Add(source, target uint64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	b := make([]byte, entWidth)
+	enc.PutUint64(b[:offWidth], source)
+	enc.PutUint64(b[offWidth:], target)
+
+	_, err := self.file.Write(b)
+	if err != nil {
+		return err
+	}
+
+	self.size += entWidth
+	self.next = max(self.next, source+1)
+	return nil
+}
+
+// Commit durably stores the translations and the next source offset.
+func (self *Offsets) Commit(next uint64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	err := self.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	// write and rename, so the checkpoint is never half written
+	tmp := filepath.Join(self.dir, checkpointFile+".tmp")
+	err = os.WriteFile(tmp, []byte(strconv.FormatUint(next, 10)), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, filepath.Join(self.dir, checkpointFile))
+	if err != nil {
+		return err
+	}
+
+	self.next = max(self.next, next)
+	return nil
+}
+
+// Translate returns the target offset of a mirrored source offset.
+func (self *Offsets) Translate(source uint64) (uint64, bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// the entries are sorted by source offset
+	lo, hi := uint64(0), self.size/entWidth
+	for lo < hi {
+		m := lo + (hi-lo)/2
+		s, target, err := self.entry(m)
+		if err != nil {
+			return 0, false, err
+		}
+
+		switch {
+		case s == source:
+			return target, true, nil
+		case s < source:
+			lo = m + 1
+		default:
+			hi = m
+		}
+	}
+
+	return 0, false, nil
+}
+
+// Close closes the translations file.
+func (self *Offsets) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.file.Close()
+}
+
+// entry reads the i-th translation
+func (self *Offsets) entry(i uint64) (uint64, uint64, error) {
+	b := make([]byte, entWidth)
+	_, err := self.file.ReadAt(b, int64(i*entWidth))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return enc.Uint64(b[:offWidth]), enc.Uint64(b[offWidth:]), nil
+}
+
+// readCheckpoint reads the next source offset, zero if there is none
+func (self *Offsets) readCheckpoint() (uint64, error) {
+	b, err := os.ReadFile(filepath.Join(self.dir, checkpointFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
@@ -0,0 +1,116 @@
+package mirror_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"logger/internal/service/mirror"
+)
+
+func TestOffsetsTranslate(t *testing.T) {
+	o, err := mirror.OpenOffsets(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	// filtered topics leave gaps in the source offsets
+	for _, e := range [][2]uint64{{0, 10}, {2, 11}, {5, 12}} {
+		if err := o.Add(e[0], e[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		source uint64
+		target uint64
+		ok     bool
+	}{
+		{0, 10, true},
+		{1, 0, false},
+		{2, 11, true},
+		{5, 12, true},
+		{6, 0, false},
+	}
+	for _, tt := range tests {
+		target, ok, err := o.Translate(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != tt.target || ok != tt.ok {
+			t.Errorf("Translate(%d) = %d, %v, want %d, %v", tt.source, target, ok, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestOffsetsNext(t *testing.T) {
+	o, err := mirror.OpenOffsets(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	if got := o.Next(); got != 0 {
+		t.Fatalf("got %d, want 0", got)
+	}
+
+	// a retry resumes after the translated records
+	if err := o.Add(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := o.Next(); got != 4 {
+		t.Fatalf("got %d after Add, want 4", got)
+	}
+
+	// records of filtered topics are skipped by the commit
+	if err := o.Commit(7); err != nil {
+		t.Fatal(err)
+	}
+	if got := o.Next(); got != 7 {
+		t.Fatalf("got %d after Commit, want 7", got)
+	}
+}
+
+func TestOffsetsReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	o, err := mirror.OpenOffsets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Add(0, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+	// translated but not committed
+	if err := o.Add(4, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a partially written entry is dropped
+	f, err := os.OpenFile(filepath.Join(dir, "translations"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+
+	o, err = mirror.OpenOffsets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	if got := o.Next(); got != 5 {
+		t.Fatalf("got %d, want 5", got)
+	}
+	if target, ok, _ := o.Translate(4); !ok || target != 6 {
+		t.Fatalf("Translate(4) = %d, %v, want 6, true", target, ok)
+	}
+}
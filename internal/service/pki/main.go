@@ -0,0 +1,325 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+/*
+This package is a small certificate authority, so a cluster can be
+bootstrapped without cfssl. It initializes a CA, issues key pairs
+and signs the CSRs of other nodes with the profiles of
+test/ca-config.json: server, client and peer, the latter being both
+for the nodes that serve and replicate from each other.
+Keys are ECDSA P-256, CA keys made by cfssl are read as well.
+*/
+
+// DefaultTTL is the validity of the certificates, as in ca-config.json
+const DefaultTTL = 8760 * time.Hour
+
+// Profile is the usage of an issued certificate.
+type Profile string
+
+const (
+	ServerProfile Profile = "server"
+	ClientProfile Profile = "client"
+	PeerProfile   Profile = "peer"
+)
+
+// extKeyUsage returns the extended key usages of the profile.
+func (self Profile) extKeyUsage() ([]x509.ExtKeyUsage, error) {
+	switch self {
+	case ServerProfile:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil
+	case ClientProfile:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, nil
+	case PeerProfile:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, nil
+	}
+
+	return nil, fmt.Errorf("unknown profile: %q", self)
+}
+
+// Request describes a certificate to issue.
+type Request struct {
+	CommonName string
+	// Hosts are the DNS names and IP addresses of the certificate
+	Hosts   []string
+	Profile Profile
+	TTL     time.Duration
+}
+
+// CA signs certificates with its key.
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// InitCA creates a self-signed CA and writes it to the files.
+func InitCA(certFile, keyFile, cn string, ttl time.Duration) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template(cn, ttl)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeKeyPair(certFile, keyFile, der, key); err != nil {
+		return nil, err
+	}
+
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// LoadCA reads the certificate and the key of a CA.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	b, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate in %q", certFile)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parseKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", keyFile, err)
+	}
+
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// Issue generates a key pair signed by the CA and writes it to the files.
+func (self *CA) Issue(req Request, certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	der, err := self.sign(req, key.Public())
+	if err != nil {
+		return err
+	}
+
+	return writeKeyPair(certFile, keyFile, der, key)
+}
+
+// SignCSR signs the PEM encoded CSR of another node and returns the
+// PEM encoded certificate. The common name and hosts of the CSR are
+// used unless the request sets them.
+func (self *CA) SignCSR(csrPEM []byte, req Request) ([]byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no certificate request found")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+
+	if req.CommonName == "" {
+		req.CommonName = csr.Subject.CommonName
+	}
+	if len(req.Hosts) == 0 {
+		req.Hosts = append(req.Hosts, csr.DNSNames...)
+		for _, ip := range csr.IPAddresses {
+			req.Hosts = append(req.Hosts, ip.String())
+		}
+		for _, u := range csr.URIs {
+			req.Hosts = append(req.Hosts, u.String())
+		}
+	}
+
+	der, err := self.sign(req, csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// CreateCSR generates a key written to the key file
+// and returns the PEM encoded CSR to be signed by the CA.
+func CreateCSR(cn string, hosts []string, keyFile string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}
+	tmpl.DNSNames, tmpl.IPAddresses, tmpl.URIs = splitHosts(hosts)
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeKey(keyFile, key); err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// sign returns the DER encoded certificate of the public key.
+func (self *CA) sign(req Request, pub crypto.PublicKey) ([]byte, error) {
+	if req.CommonName == "" {
+		return nil, errors.New("missing common name")
+	}
+
+	usage, err := req.Profile.extKeyUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template(req.CommonName, req.TTL)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.ExtKeyUsage = usage
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	tmpl.DNSNames, tmpl.IPAddresses, tmpl.URIs = splitHosts(req.Hosts)
+
+	// a certificate never outlives its CA
+	if tmpl.NotAfter.After(self.Cert.NotAfter) {
+		tmpl.NotAfter = self.Cert.NotAfter
+	}
+
+	return x509.CreateCertificate(rand.Reader, tmpl, self.Cert, pub, self.Key)
+}
+
+// template returns a certificate template with a random serial number.
+func template(cn string, ttl time.Duration) (*x509.Certificate, error) {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		// tolerate clock skew between the nodes
+		NotBefore: now.Add(-5 * time.Minute),
+		NotAfter:  now.Add(ttl),
+	}, nil
+}
+
+// splitHosts separates the IP addresses and the URIs,
+// e.g. spiffe://team/service, from the DNS names.
+func splitHosts(hosts []string) (names []string, ips []net.IP, uris []*url.URL) {
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip)
+		} else if u, err := url.Parse(h); err == nil && u.Scheme != "" {
+			uris = append(uris, u)
+		} else {
+			names = append(names, h)
+		}
+	}
+
+	return names, ips, uris
+}
+
+// parseKey reads a PEM encoded EC, RSA or PKCS #8 private key.
+func parseKey(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no private key found")
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case *rsa.PrivateKey:
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key %T", key)
+}
+
+// writeKeyPair writes the certificate and its key.
+func writeKeyPair(certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	if err := writeKey(keyFile, key); err != nil {
+		return err
+	}
+
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return os.WriteFile(certFile, b, 0644)
+}
+
+// writeKey writes the private key readable by the owner only.
+func writeKey(keyFile string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	b := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	return os.WriteFile(keyFile, b, 0600)
+}
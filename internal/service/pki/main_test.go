@@ -0,0 +1,197 @@
+package pki_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"logger/internal/service/pki"
+)
+
+// load reads the issued certificate.
+func load(t *testing.T, certFile string) *x509.Certificate {
+	t.Helper()
+
+	b, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		t.Fatalf("no certificate in %s", certFile)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestIssue(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	if _, err := pki.InitCA(file("ca.pem"), file("ca-key.pem"), "golog CA", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// the CA is loaded again to issue, as the cert command does
+	ca, err := pki.LoadCA(file("ca.pem"), file("ca-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range []struct {
+		pki.Request
+		name string
+	}{
+		{pki.Request{CommonName: "node-1", Hosts: []string{"localhost", "127.0.0.1"}, Profile: pki.ServerProfile}, "server"},
+		{pki.Request{CommonName: "peer", Hosts: []string{"localhost", "127.0.0.1"}, Profile: pki.PeerProfile}, "peer"},
+		{pki.Request{CommonName: "alice", Hosts: []string{"spiffe://team/alice"}, Profile: pki.ClientProfile}, "client"},
+	} {
+		if err := ca.Issue(req.Request, file(req.name+".pem"), file(req.name+"-key.pem")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	tests := []struct {
+		name  string
+		usage x509.ExtKeyUsage
+		host  string
+		ok    bool
+	}{
+		{"server", x509.ExtKeyUsageServerAuth, "127.0.0.1", true},
+		{"server", x509.ExtKeyUsageServerAuth, "localhost", true},
+		{"server", x509.ExtKeyUsageServerAuth, "example.com", false},
+		{"server", x509.ExtKeyUsageClientAuth, "", false},
+		{"peer", x509.ExtKeyUsageServerAuth, "127.0.0.1", true},
+		{"peer", x509.ExtKeyUsageClientAuth, "", true},
+		{"client", x509.ExtKeyUsageClientAuth, "", true},
+		{"client", x509.ExtKeyUsageServerAuth, "", false},
+	}
+
+	for _, tt := range tests {
+		cert := load(t, file(tt.name+".pem"))
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			DNSName:   tt.host,
+			KeyUsages: []x509.ExtKeyUsage{tt.usage},
+		})
+		if (err == nil) != tt.ok {
+			t.Errorf("%s for %v at %q: got %v, want ok %v", tt.name, tt.usage, tt.host, err, tt.ok)
+		}
+	}
+
+	client := load(t, file("client.pem"))
+	if len(client.URIs) != 1 || client.URIs[0].String() != "spiffe://team/alice" {
+		t.Fatalf("got URIs %v, want spiffe://team/alice", client.URIs)
+	}
+
+	// the certificates never outlive the CA
+	if load(t, file("peer.pem")).NotAfter.After(ca.Cert.NotAfter) {
+		t.Fatal("the peer certificate outlives the CA")
+	}
+
+	// the server and the peer authenticate each other
+	serverPair, err := tls.LoadX509KeyPair(file("server.pem"), file("server-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerPair, err := tls.LoadX509KeyPair(file("peer.pem"), file("peer-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			accepted <- err.Error()
+			return
+		}
+		defer conn.Close()
+
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			accepted <- err.Error()
+			return
+		}
+		accepted <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		Certificates: []tls.Certificate{peerPair},
+		RootCAs:      roots,
+		ServerName:   "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if cn := <-accepted; cn != "peer" {
+		t.Fatalf("server got %q, want the peer", cn)
+	}
+}
+
+func TestSignCSR(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := pki.InitCA(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"), "golog CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another node keeps its key and sends the request
+	csr, err := pki.CreateCSR("node-2", []string{"node-2.cluster.local", "10.0.0.2"}, filepath.Join(dir, "node-2-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ca.SignCSR(csr, pki.Request{Profile: pki.PeerProfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "node-2.pem")
+	if err := os.WriteFile(certFile, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cert := load(t, certFile)
+	if cert.Subject.CommonName != "node-2" || len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.2")) {
+		t.Fatalf("got %s with %v, want the name and hosts of the request", cert.Subject.CommonName, cert.IPAddresses)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "node-2.cluster.local"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, filepath.Join(dir, "node-2-key.pem")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ca.SignCSR([]byte("not a csr"), pki.Request{Profile: pki.PeerProfile}); err == nil {
+		t.Fatal("signed garbage")
+	}
+	if _, err := ca.SignCSR(csr, pki.Request{Profile: "unknown"}); err == nil {
+		t.Fatal("signed with an unknown profile")
+	}
+}
@@ -0,0 +1,180 @@
+package quota
+
+import (
+	"expvar"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+This package enforces the quotas of the subjects with token buckets,
+one for the records and one for the bytes of every subject and operation.
+A bucket holds at most one second of its rate. Calls are allowed while
+both buckets have tokens left and charged once their size is known,
+so a large call may leave a bucket in debt that the following calls wait out.
+The usage of every subject is published with expvar under golog_quota.
+*/
+
+// operations with a quota
+const (
+	Produce = "produce"
+	Consume = "consume"
+)
+
+// metrics holds the usage of every subject
+var (
+	metrics   = expvar.NewMap("golog_quota")
+	metricsMu sync.Mutex
+)
+
+// Source returns the quota of a subject for an operation,
+// in records and bytes per second, a zero limit is unlimited.
+type Source interface {
+	Quota(subject, op string) (records, bytes float64, ok bool)
+}
+
+// Limiter enforces the quotas of the source.
+type Limiter struct {
+	source Source
+
+	mu      sync.Mutex
+	buckets map[key]*buckets
+	now     func() time.Time
+}
+
+type key struct {
+	subject string
+	op      string
+}
+
+type buckets struct {
+	records bucket
+	bytes   bucket
+}
+
+// New creates a limiter of the quotas of the source.
+func New(source Source) *Limiter {
+	return &Limiter{
+		source:  source,
+		buckets: make(map[key]*buckets),
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether the subject may call the operation now,
+// otherwise it returns how long to wait before retrying.
+func (self *Limiter) Allow(subject, op string) (time.Duration, bool) {
+	records, bytes, ok := self.source.Quota(subject, op)
+	if !ok {
+		return 0, true
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	b := self.bucket(subject, op)
+	now := self.now()
+	b.records.refill(records, now)
+	b.bytes.refill(bytes, now)
+
+	wait := max(b.records.wait(), b.bytes.wait())
+	if wait > 0 {
+		counter(subject).Add(op+"_throttled", 1)
+		return wait, false
+	}
+
+	return 0, true
+}
+
+// Charge takes the records and bytes of a call from the buckets.
+func (self *Limiter) Charge(subject, op string, records, bytes int) {
+	m := counter(subject)
+	m.Add(op+"_records", int64(records))
+	m.Add(op+"_bytes", int64(bytes))
+
+	recordRate, byteRate, ok := self.source.Quota(subject, op)
+	if !ok {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	b := self.bucket(subject, op)
+	now := self.now()
+	b.records.refill(recordRate, now)
+	b.bytes.refill(byteRate, now)
+	b.records.take(float64(records))
+	b.bytes.take(float64(bytes))
+}
+
+// bucket returns the buckets of the subject and operation,
+// new buckets start full.
+func (self *Limiter) bucket(subject, op string) *buckets {
+	k := key{subject: subject, op: op}
+	b, ok := self.buckets[k]
+	if !ok {
+		b = &buckets{}
+		b.records.tokens = math.Inf(1)
+		b.bytes.tokens = math.Inf(1)
+		self.buckets[k] = b
+	}
+
+	return b
+}
+
+// counter returns the metrics of the subject.
+func counter(subject string) *expvar.Map {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if m, ok := metrics.Get(subject).(*expvar.Map); ok {
+		return m
+	}
+
+	m := new(expvar.Map)
+	metrics.Set(subject, m)
+
+	return m
+}
+
+// bucket is a token bucket of one second of its rate.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens since the last refill,
+// the rate follows the changes of the quota.
+func (self *bucket) refill(rate float64, now time.Time) {
+	self.rate = rate
+	if rate <= 0 {
+		return
+	}
+
+	if !self.last.IsZero() {
+		self.tokens += rate * now.Sub(self.last).Seconds()
+	}
+	self.tokens = min(self.tokens, rate)
+	self.last = now
+}
+
+// take removes tokens, the bucket may go into debt.
+func (self *bucket) take(n float64) {
+	if self.rate <= 0 {
+		return
+	}
+
+	self.tokens -= n
+}
+
+// wait returns how long until the bucket has tokens again.
+func (self *bucket) wait() time.Duration {
+	if self.rate <= 0 || self.tokens > 0 {
+		return 0
+	}
+
+	return time.Duration((-self.tokens/self.rate)*float64(time.Second)) + time.Millisecond
+}
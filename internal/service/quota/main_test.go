@@ -0,0 +1,124 @@
+package quota
+
+import (
+	"testing"
+	"time"
+)
+
+// rates is a source of fixed quotas by subject.
+type rates map[string][2]float64
+
+func (self rates) Quota(subject, op string) (float64, float64, bool) {
+	r, ok := self[subject]
+	return r[0], r[1], ok
+}
+
+func TestLimiter(t *testing.T) {
+	source := rates{
+		// 2 records and 100 bytes per second
+		"limited": {2, 100},
+		// only the bytes are limited
+		"bytes": {0, 100},
+	}
+
+	type step struct {
+		// time passed since the previous step
+		advance time.Duration
+		// records and bytes charged before calling Allow
+		records, bytes int
+		wantOK         bool
+		wantWait       time.Duration
+	}
+
+	tests := []struct {
+		name    string
+		subject string
+		steps   []step
+	}{
+		{
+			name:    "unknown subjects are unlimited",
+			subject: "unknown",
+			steps: []step{
+				{records: 1000, bytes: 1 << 20, wantOK: true},
+			},
+		},
+		{
+			name:    "new buckets start full",
+			subject: "limited",
+			steps: []step{
+				{wantOK: true},
+				{records: 1, bytes: 10, wantOK: true},
+			},
+		},
+		{
+			name:    "an empty bucket waits for the next token",
+			subject: "limited",
+			steps: []step{
+				{records: 2, bytes: 10, wantWait: time.Millisecond},
+				{records: 1, wantWait: 500*time.Millisecond + time.Millisecond},
+			},
+		},
+		{
+			name:    "a large call leaves the bucket in debt",
+			subject: "limited",
+			steps: []step{
+				{records: 1, bytes: 300, wantWait: 2*time.Second + time.Millisecond},
+				// the debt is paid off at the rate of the quota
+				{advance: time.Second, wantWait: time.Second + time.Millisecond},
+				{advance: 1100 * time.Millisecond, wantOK: true},
+			},
+		},
+		{
+			name:    "refills are capped at one second",
+			subject: "limited",
+			steps: []step{
+				{advance: time.Hour, wantOK: true},
+				{records: 3, bytes: 10, wantWait: 500*time.Millisecond + time.Millisecond},
+			},
+		},
+		{
+			name:    "a zero rate is unlimited",
+			subject: "bytes",
+			steps: []step{
+				{records: 1000, bytes: 50, wantOK: true},
+				{records: 1000, bytes: 100, wantWait: 500*time.Millisecond + time.Millisecond},
+				{advance: 600 * time.Millisecond, wantOK: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			l := New(source)
+			l.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				if s.records > 0 || s.bytes > 0 {
+					l.Charge(tt.subject, Produce, s.records, s.bytes)
+				}
+
+				wait, ok := l.Allow(tt.subject, Produce)
+				if ok != s.wantOK || wait != s.wantWait {
+					t.Fatalf("step %d: got %v, %t, want %v, %t", i, wait, ok, s.wantWait, s.wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterSeparatesOperations(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(rates{"limited": {1, 100}})
+	l.now = func() time.Time { return now }
+
+	l.Charge("limited", Produce, 1, 10)
+
+	if _, ok := l.Allow("limited", Produce); ok {
+		t.Fatal("produce allowed over its quota")
+	}
+	if _, ok := l.Allow("limited", Consume); !ok {
+		t.Fatal("consume charged for produce")
+	}
+}
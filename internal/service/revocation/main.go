@@ -0,0 +1,335 @@
+package revocation
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"logger/internal/service/discovery"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+This package locks out certificates before they expire.
+A certificate is revoked when its serial number is in the CRL file
+or in the revoked file, a list of hex serial numbers, one per line.
+Both files are reloaded when they change. The revoked file is edited
+through Revoke and Unrevoke, the CRL file is only read.
+The mTLS authenticator checks the certificate of every call.
+*/
+
+// checkInterval is the minimum time between two checks of the files
+const checkInterval = time.Second
+
+// ErrRevoked is returned for a revoked certificate.
+type ErrRevoked struct {
+	Serial string
+}
+
+func (self ErrRevoked) GRPCStatus() *status.Status {
+	return status.New(
+		codes.Unauthenticated,
+		fmt.Sprintf("certificate %s is revoked", self.Serial),
+	)
+}
+
+func (self ErrRevoked) Error() string {
+	return self.GRPCStatus().Err().Error()
+}
+
+// List holds the revoked serial numbers.
+type List struct {
+	crlFile     string
+	revokedFile string
+
+	mu       sync.Mutex
+	revoked  map[string]struct{}
+	crl      map[string]struct{}
+	modTimes [2]time.Time
+	checked  time.Time
+}
+
+// New loads the revoked serial numbers of the files,
+// a file that is not set or doesn't exist yet revokes nothing.
+func New(crlFile, revokedFile string) (*List, error) {
+	l := &List{
+		crlFile:     crlFile,
+		revokedFile: revokedFile,
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Check returns ErrRevoked if the certificate is revoked.
+func (self *List) Check(cert *x509.Certificate) error {
+	self.reload()
+
+	serial := cert.SerialNumber.Text(16)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	_, revoked := self.revoked[serial]
+	_, inCRL := self.crl[serial]
+	if revoked || inCRL {
+		return ErrRevoked{Serial: serial}
+	}
+
+	return nil
+}
+
+// Revoke adds the serial number to the revoked file.
+func (self *List) Revoke(serial string) error {
+	serial, err := ParseSerial(serial)
+	if err != nil {
+		return err
+	}
+
+	return self.update(func(revoked map[string]struct{}) {
+		revoked[serial] = struct{}{}
+	})
+}
+
+// Unrevoke removes the serial number from the revoked file,
+// a serial number of the CRL stays revoked.
+func (self *List) Unrevoke(serial string) error {
+	serial, err := ParseSerial(serial)
+	if err != nil {
+		return err
+	}
+
+	return self.update(func(revoked map[string]struct{}) {
+		delete(revoked, serial)
+	})
+}
+
+// Serials returns the revoked serial numbers of both files.
+func (self *List) Serials() []string {
+	self.reload()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	serials := make([]string, 0, len(self.revoked)+len(self.crl))
+	for s := range self.revoked {
+		serials = append(serials, s)
+	}
+	for s := range self.crl {
+		if _, ok := self.revoked[s]; !ok {
+			serials = append(serials, s)
+		}
+	}
+	sort.Strings(serials)
+
+	return serials
+}
+
+// Commands returns the cluster-wide commands that edit the revoked file.
+func (self *List) Commands() map[string]discovery.CommandHandler {
+	return map[string]discovery.CommandHandler{
+		"revoke-cert": func(args []byte) (string, error) {
+			return "revoked", self.Revoke(string(args))
+		},
+		"unrevoke-cert": func(args []byte) (string, error) {
+			return "unrevoked", self.Unrevoke(string(args))
+		},
+	}
+}
+
+// ParseSerial normalizes a hex serial number, e.g. 0A:1B or 0x0a1b.
+func ParseSerial(serial string) (string, error) {
+	s := strings.ToLower(strings.TrimSpace(serial))
+	s = strings.TrimPrefix(s, "0x")
+	s = strings.ReplaceAll(s, ":", "")
+
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		return "", fmt.Errorf("invalid serial number: %q", serial)
+	}
+
+	return n.Text(16), nil
+}
+
+// update edits the revoked serial numbers and writes the revoked file.
+func (self *List) update(edit func(revoked map[string]struct{})) error {
+	if self.revokedFile == "" {
+		return fmt.Errorf("no revoked file is configured")
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	revoked := make(map[string]struct{}, len(self.revoked)+1)
+	for s := range self.revoked {
+		revoked[s] = struct{}{}
+	}
+	edit(revoked)
+
+	serials := make([]string, 0, len(revoked))
+	for s := range revoked {
+		serials = append(serials, s)
+	}
+	sort.Strings(serials)
+
+	// write a new file and move it over the old one,
+	// so a reader never sees half of the list
+	var b bytes.Buffer
+	for _, s := range serials {
+		fmt.Fprintln(&b, s)
+	}
+
+	tmp := self.revokedFile + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, self.revokedFile); err != nil {
+		return err
+	}
+
+	self.revoked = revoked
+	self.modTimes = self.stat()
+
+	return nil
+}
+
+// reload loads the files again when they changed since the last load.
+// The current lists are kept if the new ones fail to load.
+func (self *List) reload() {
+	self.mu.Lock()
+	if time.Since(self.checked) < checkInterval {
+		self.mu.Unlock()
+		return
+	}
+	self.checked = time.Now()
+	modTimes := self.stat()
+	changed := self.modTimes != modTimes
+	// a failed load is not retried until the files change again
+	self.modTimes = modTimes
+	self.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := self.load(); err != nil {
+		log.Printf("[ERROR] golog: failed to reload revoked certificates: %s", err)
+	}
+}
+
+// load reads both files.
+func (self *List) load() error {
+	modTimes := self.stat()
+
+	revoked, err := readRevoked(self.revokedFile)
+	if err != nil {
+		return err
+	}
+
+	crl, err := readCRL(self.crlFile)
+	if err != nil {
+		return err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.revoked = revoked
+	self.crl = crl
+	self.modTimes = modTimes
+
+	return nil
+}
+
+// stat returns the modification times of the files.
+func (self *List) stat() [2]time.Time {
+	var times [2]time.Time
+	for i, path := range []string{self.crlFile, self.revokedFile} {
+		if path == "" {
+			continue
+		}
+
+		if info, err := os.Stat(path); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+
+	return times
+}
+
+// readRevoked reads the serial numbers of the revoked file,
+// empty lines and lines starting with # are skipped.
+func readRevoked(path string) (map[string]struct{}, error) {
+	revoked := make(map[string]struct{})
+	if path == "" {
+		return revoked, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return revoked, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		serial, err := ParseSerial(line)
+		if err != nil {
+			return nil, err
+		}
+		revoked[serial] = struct{}{}
+	}
+
+	return revoked, scanner.Err()
+}
+
+// readCRL reads the serial numbers of a PEM or DER encoded CRL.
+func readCRL(path string) (map[string]struct{}, error) {
+	crl := make(map[string]struct{})
+	if path == "" {
+		return crl, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return crl, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+
+	list, err := x509.ParseRevocationList(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse crl %q: %w", path, err)
+	}
+
+	for _, entry := range list.RevokedCertificateEntries {
+		crl[entry.SerialNumber.Text(16)] = struct{}{}
+	}
+
+	return crl, nil
+}
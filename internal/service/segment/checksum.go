@@ -0,0 +1,138 @@
+package segment
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io/fs"
+	v1 "logger/gen/go/v1"
+	"os"
+)
+
+// checksumPrime is the base of the rolling checksum
+const checksumPrime uint64 = 1099511628211
+
+// checksumVersion changes with the hash of the records,
+// so the checksum files of an older hash are ignored
+const checksumVersion uint64 = 2
+
+// checksum is the rolling checksum of a range of records
+type checksum struct {
+	sum   uint64
+	count uint64
+}
+
+// Checksum returns the rolling checksum of the records in [start, end)
+// and the number of records hashed. The checksum of a sealed segment
+// is kept in a file next to its index, so it is hashed only once.
+func (self *Segment) Checksum(start, end uint64, sealed bool) (uint64, uint64, error) {
+	if start < self.BaseOffset {
+		start = self.BaseOffset
+	}
+	if end > self.NextOffset {
+		end = self.NextOffset
+	}
+
+	whole := start == self.BaseOffset && end == self.NextOffset
+	if whole && sealed && self.sum != nil {
+		return self.sum.sum, self.sum.count, nil
+	}
+
+	var sum, count uint64
+	for off := start; off < end; off++ {
+		record, err := self.Read(off)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		sum, count = CombineChecksums(sum, count, HashRecord(record), 1)
+	}
+
+	if whole && sealed {
+		self.sum = &checksum{sum: sum, count: count}
+		err := self.saveChecksum()
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return sum, count, nil
+}
+
+// loadChecksum reads the checksum file of the segment, which is
+// ignored when it doesn't cover the records of the segment anymore.
+func (self *Segment) loadChecksum() error {
+	p, err := os.ReadFile(self.sumPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(p) != 24 || binary.BigEndian.Uint64(p[:8]) != checksumVersion {
+		return nil
+	}
+
+	sum := &checksum{
+		sum:   binary.BigEndian.Uint64(p[8:16]),
+		count: binary.BigEndian.Uint64(p[16:]),
+	}
+	if sum.count == self.NextOffset-self.BaseOffset {
+		self.sum = sum
+	}
+
+	return nil
+}
+
+// saveChecksum writes the cached checksum to the checksum file.
+func (self *Segment) saveChecksum() error {
+	p := make([]byte, 24)
+	binary.BigEndian.PutUint64(p[:8], checksumVersion)
+	binary.BigEndian.PutUint64(p[8:16], self.sum.sum)
+	binary.BigEndian.PutUint64(p[16:], self.sum.count)
+
+	return os.WriteFile(self.sumPath, p, 0644)
+}
+
+// removeChecksum drops the cached checksum and its file.
+func (self *Segment) removeChecksum() error {
+	self.sum = nil
+
+	err := os.Remove(self.sumPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// CombineChecksums returns the checksum of two consecutive ranges.
+func CombineChecksums(sum, count, next, nextCount uint64) (uint64, uint64) {
+	return sum*pow(checksumPrime, nextCount) + next, count + nextCount
+}
+
+// HashRecord hashes the topic and the value of a record,
+// the topic is prefixed with its length so the two can't blur.
+func HashRecord(record *v1.Record) uint64 {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(record.Topic)))
+
+	h := fnv.New64a()
+	h.Write(n[:])
+	h.Write([]byte(record.Topic))
+	h.Write(record.Value)
+	return h.Sum64()
+}
+
+// pow returns b^e, wrapping around like the checksum does
+func pow(b, e uint64) uint64 {
+	r := uint64(1)
+	for e > 0 {
+		if e&1 == 1 {
+			r *= b
+		}
+		b *= b
+		e >>= 1
+	}
+	return r
+}
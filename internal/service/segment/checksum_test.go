@@ -0,0 +1,40 @@
+package segment
+
+import (
+	"testing"
+
+	v1 "logger/gen/go/v1"
+)
+
+func TestHashRecordCoversTheTopic(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *v1.Record
+	}{
+		{
+			name: "topics differ",
+			a:    &v1.Record{Topic: "orders", Value: []byte("hello")},
+			b:    &v1.Record{Topic: "payments", Value: []byte("hello")},
+		},
+		{
+			name: "topic and value split differently",
+			a:    &v1.Record{Topic: "ab", Value: []byte("c")},
+			b:    &v1.Record{Topic: "a", Value: []byte("bc")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if HashRecord(tt.a) == HashRecord(tt.b) {
+				t.Fatalf("%v and %v hash the same", tt.a, tt.b)
+			}
+		})
+	}
+
+	// the offset isn't part of the content
+	a := &v1.Record{Topic: "orders", Value: []byte("hello"), Offset: 1}
+	b := &v1.Record{Topic: "orders", Value: []byte("hello"), Offset: 7}
+	if HashRecord(a) != HashRecord(b) {
+		t.Fatal("the same record hashes differently at another offset")
+	}
+}
@@ -28,6 +28,12 @@ type Segment struct {
 
 	// max number of bytes in the segment
 	config *config.Config
+
+	// cached checksum of the sealed segment
+	sum *checksum
+
+	// file the cached checksum is kept in
+	sumPath string
 }
 
 // New creates a new segment from a BaseOffset
@@ -35,6 +41,7 @@ func New(dir string, baseOffset uint64, c *config.Config) (*Segment, error) {
 	s := &Segment{
 		BaseOffset: baseOffset,
 		config:     c,
+		sumPath:    path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ".sum")),
 	}
 
 	// open the store file
@@ -76,6 +83,11 @@ func New(dir string, baseOffset uint64, c *config.Config) (*Segment, error) {
 		s.NextOffset = baseOffset + uint64(off) + 1
 	}
 
+	err = s.loadChecksum()
+	if err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
@@ -128,9 +140,36 @@ func (self *Segment) Read(off uint64) (*v1.Record, error) {
 	return &record, err
 }
 
+// Rewind removes the records from the offset onwards
+func (self *Segment) Rewind(off uint64) error {
+	if off >= self.NextOffset {
+		return nil
+	}
+
+	_, pos, err := self.index.Read(int64(off - self.BaseOffset))
+	if err != nil {
+		return err
+	}
+
+	err = self.Store.Shrink(pos)
+	if err != nil {
+		return err
+	}
+
+	self.index.Shrink(off - self.BaseOffset)
+	self.NextOffset = off
+
+	return self.removeChecksum()
+}
+
+// IndexSize returns the bytes written to the index and its size on disk
+func (self *Segment) IndexSize() (uint64, uint64) {
+	return self.index.Size, self.index.Cap()
+}
+
 func (self *Segment) IsMaxed() bool {
 	return self.Store.Size >= self.config.Segment.MaxStoreBytes ||
-			self.index.Size >= self.config.Segment.MaxIndexBytes
+			self.index.IsMaxed(self.config.Segment.MaxIndexBytes)
 }
 
 func (self *Segment) Close() error {
@@ -164,7 +203,7 @@ func (self *Segment) Remove() error {
 		return err
 	}
 
-	return nil
+	return self.removeChecksum()
 }
 
 // NearestMultiple returns the nearest multiple of k
@@ -0,0 +1,70 @@
+package loadbalance
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+var _ base.PickerBuilder = (*Picker)(nil)
+var _ balancer.Picker = (*Picker)(nil)
+
+// Picker sends produce calls to the leader
+// and spreads the other calls across the followers.
+type Picker struct {
+	mu sync.RWMutex
+
+	leader    balancer.SubConn
+	followers []balancer.SubConn
+	current   uint64
+}
+
+func init() {
+	balancer.Register(
+		base.NewBalancerBuilder(Name, &Picker{}, base.Config{}),
+	)
+}
+
+// Build creates a picker from the ready sub connections.
+func (self *Picker) Build(info base.PickerBuildInfo) balancer.Picker {
+	p := &Picker{}
+	for sc, scInfo := range info.ReadySCs {
+		isLeader, _ := scInfo.Address.Attributes.Value(isLeaderAttr).(bool)
+		if isLeader {
+			p.leader = sc
+			continue
+		}
+		p.followers = append(p.followers, sc)
+	}
+
+	return p
+}
+
+// Pick picks the sub connection for the call.
+func (self *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	var result balancer.PickResult
+	if strings.Contains(info.FullMethodName, "Produce") || len(self.followers) == 0 {
+		result.SubConn = self.leader
+	} else {
+		result.SubConn = self.nextFollower()
+	}
+
+	if result.SubConn == nil {
+		return result, balancer.ErrNoSubConnAvailable
+	}
+
+	return result, nil
+}
+
+// nextFollower returns the followers in round robin.
+func (self *Picker) nextFollower() balancer.SubConn {
+	cur := atomic.AddUint64(&self.current, 1)
+
+	return self.followers[cur%uint64(len(self.followers))]
+}
@@ -0,0 +1,191 @@
+package loadbalance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	v1 "logger/gen/go/v1"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+/*
+This package implements client side load balancing.
+The resolver watches the servers with the WatchServers rpc,
+so membership changes are picked up as they happen,
+and the picker sends produce calls to the leader
+and spreads consume calls across the followers.
+Use it by dialing "golog://<address of any server>".
+*/
+
+const (
+	Name = "golog"
+
+	isLeaderAttr = "is_leader"
+
+	// resolveTimeout bounds a GetServers call
+	resolveTimeout = 5 * time.Second
+	// retryInterval is the wait before watching again after an error
+	retryInterval = time.Second
+)
+
+var _ resolver.Builder = (*Resolver)(nil)
+var _ resolver.Resolver = (*Resolver)(nil)
+
+// Resolver resolves a golog:// target into the servers of the cluster.
+type Resolver struct {
+	mu sync.Mutex
+
+	clientConn    resolver.ClientConn
+	resolverConn  *grpc.ClientConn
+	serviceConfig *serviceconfig.ParseResult
+
+	close chan struct{}
+}
+
+func init() {
+	resolver.Register(&Resolver{})
+}
+
+// Build connects to the target server and resolves the servers.
+func (self *Resolver) Build(
+	target resolver.Target,
+	cc resolver.ClientConn,
+	opts resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	r := &Resolver{
+		clientConn: cc,
+		close:      make(chan struct{}),
+	}
+
+	var dialOpts []grpc.DialOption
+	if opts.DialCreds != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(opts.DialCreds))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	r.serviceConfig = cc.ParseServiceConfig(
+		fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, Name),
+	)
+
+	var err error
+	r.resolverConn, err = grpc.NewClient(target.Endpoint(), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	r.ResolveNow(resolver.ResolveNowOptions{})
+
+	go r.watch()
+
+	return r, nil
+}
+
+// Scheme returns the scheme of the resolver.
+func (self *Resolver) Scheme() string {
+	return Name
+}
+
+// ResolveNow asks for the servers and updates the client connection.
+func (self *Resolver) ResolveNow(resolver.ResolveNowOptions) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	client := v1.NewLogClient(self.resolverConn)
+	res, err := client.GetServers(ctx, &v1.GetServersRequest{})
+	if err != nil {
+		self.clientConn.ReportError(err)
+		return
+	}
+
+	self.update(res)
+}
+
+// update sends the servers to the client connection,
+// the lock must be held.
+func (self *Resolver) update(res *v1.GetServersResponse) {
+	var addrs []resolver.Address
+	for _, server := range res.Servers {
+		addrs = append(addrs, resolver.Address{
+			Addr:       server.RpcAddr,
+			Attributes: attributes.New(isLeaderAttr, server.IsLeader),
+		})
+	}
+
+	err := self.clientConn.UpdateState(resolver.State{
+		Addresses:     addrs,
+		ServiceConfig: self.serviceConfig,
+	})
+	if err != nil {
+		log.Printf("[ERROR] golog: failed to update resolver state: %v", err)
+	}
+}
+
+// watch follows the membership changes until the resolver is closed,
+// watching again after the errors.
+func (self *Resolver) watch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-self.close
+		cancel()
+	}()
+
+	client := v1.NewLogClient(self.resolverConn)
+	for {
+		err := self.follow(ctx, client)
+		if ctx.Err() != nil {
+			return
+		}
+		self.clientConn.ReportError(err)
+
+		select {
+		case <-self.close:
+			return
+		case <-time.After(retryInterval):
+		}
+
+		// catch up on the changes missed in between
+		self.ResolveNow(resolver.ResolveNowOptions{})
+	}
+}
+
+// follow updates the client connection with every list of servers sent.
+func (self *Resolver) follow(ctx context.Context, client v1.LogClient) error {
+	stream, err := client.WatchServers(ctx, &v1.GetServersRequest{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		self.mu.Lock()
+		self.update(res)
+		self.mu.Unlock()
+	}
+}
+
+// Close closes the resolver.
+func (self *Resolver) Close() {
+	close(self.close)
+
+	err := self.resolverConn.Close()
+	if err != nil {
+		log.Printf("[ERROR] golog: failed to close resolver: %v", err)
+	}
+}
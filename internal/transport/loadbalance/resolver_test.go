@@ -0,0 +1,271 @@
+package loadbalance_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/authn"
+	"logger/internal/service/config"
+	"logger/internal/service/discovery"
+	logger "logger/internal/service/log"
+	"logger/internal/transport/loadbalance"
+	"logger/internal/transport/rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// node is a server of the in-process cluster.
+type node struct {
+	name       string
+	rpcAddr    string
+	log        *logger.Log
+	server     *grpc.Server
+	membership *discovery.Membership
+}
+
+// allow lets every subject do everything.
+type allow struct{}
+
+func (allow) Authorize(subject, object, action string) error { return nil }
+
+// anonymous authenticates every call as root.
+type anonymous struct{}
+
+func (anonymous) Authenticate(ctx context.Context) (string, error) { return "root", nil }
+
+// noop ignores the discovered nodes.
+type noop struct{}
+
+func (noop) Join(discovery.Node) error  { return nil }
+func (noop) Leave(discovery.Node) error { return nil }
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+// startNode serves a log and joins the cluster of the join address.
+func startNode(t *testing.T, name string, join []string) (*node, string) {
+	t.Helper()
+
+	l, err := logger.New(t.TempDir(), &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := &node{name: name, rpcAddr: ln.Addr().String(), log: l}
+
+	gossipAddr := freeAddr(t)
+	n.membership, err = discovery.New(noop{}, discovery.Config{
+		NodeName:       name,
+		BindAddr:       gossipAddr,
+		RPCAddr:        n.rpcAddr,
+		StartJoinAddrs: join,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.server, err = rpc.New(&rpc.Config{
+		CommitLog:      l,
+		Authorize:      allow{},
+		Authenticators: []authn.Authenticator{anonymous{}},
+		Cluster:        n.membership,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go n.server.Serve(ln)
+
+	t.Cleanup(n.stop)
+
+	return n, gossipAddr
+}
+
+func (self *node) stop() {
+	self.membership.Leave()
+	self.server.Stop()
+	self.log.Close()
+}
+
+// clientConn records the states sent by the resolver.
+type clientConn struct {
+	resolver.ClientConn
+
+	mu     sync.Mutex
+	states []resolver.State
+}
+
+func (self *clientConn) UpdateState(state resolver.State) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.states = append(self.states, state)
+	return nil
+}
+
+func (self *clientConn) ReportError(error) {}
+
+func (self *clientConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return &serviceconfig.ParseResult{}
+}
+
+// servers returns the addresses of the last state, the leader first.
+func (self *clientConn) servers() []string {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.states) == 0 {
+		return nil
+	}
+
+	var leader string
+	var followers []string
+	for _, addr := range self.states[len(self.states)-1].Addresses {
+		if isLeader, _ := addr.Attributes.Value("is_leader").(bool); isLeader {
+			leader = addr.Addr
+			continue
+		}
+		followers = append(followers, addr.Addr)
+	}
+	sort.Strings(followers)
+
+	return append([]string{leader}, followers...)
+}
+
+func waitFor(t *testing.T, want fmt.Stringer, got func() string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for got() != want.String() {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %s, want %s", got(), want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// addrs is the leader followed by the followers, which are
+// compared sorted as the resolver doesn't order them.
+type addrs []string
+
+func (self addrs) String() string {
+	followers := append([]string{}, self[1:]...)
+	sort.Strings(followers)
+
+	return fmt.Sprint(append([]string{self[0]}, followers...))
+}
+
+func TestResolverFollowsMembership(t *testing.T) {
+	n0, join := startNode(t, "node-0", nil)
+	n1, _ := startNode(t, "node-1", []string{join})
+
+	cc := &clientConn{}
+	r, err := (&loadbalance.Resolver{}).Build(
+		resolver.Target{URL: *mustParse(t, "golog:///"+n0.rpcAddr)},
+		cc,
+		resolver.BuildOptions{DialCreds: insecure.NewCredentials()},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	servers := func() string { return fmt.Sprint(cc.servers()) }
+
+	// node-0 leads, being the lowest name
+	waitFor(t, addrs{n0.rpcAddr, n1.rpcAddr}, servers)
+
+	// a joining node is pushed without waiting for a poll
+	n2, _ := startNode(t, "node-2", []string{join})
+	waitFor(t, addrs{n0.rpcAddr, n1.rpcAddr, n2.rpcAddr}, servers)
+
+	// a leaving node is removed as well
+	n1.membership.Leave()
+	waitFor(t, addrs{n0.rpcAddr, n2.rpcAddr}, servers)
+}
+
+func mustParse(t *testing.T, target string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestPickerRoutesToLeader(t *testing.T) {
+	n0, join := startNode(t, "node-0", nil)
+	n1, _ := startNode(t, "node-1", []string{join})
+
+	cc, err := grpc.NewClient(
+		"golog:///"+n1.rpcAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	client := v1.NewLogClient(cc)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// wait for both members to be resolved
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res, err := client.GetServers(ctx, &v1.GetServersRequest{})
+		if err == nil && len(res.Servers) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("servers not resolved: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Produce(ctx, &v1.ProduceRequest{
+			Record: &v1.Record{Value: []byte("hello")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every record went to the leader
+	if _, err := n0.log.Read(2); err != nil {
+		t.Fatalf("leader misses the records: %v", err)
+	}
+	if _, err := n1.log.Read(0); err == nil {
+		t.Fatal("follower got a produced record")
+	}
+
+	// consume calls go to the follower
+	if _, err := client.Consume(ctx, &v1.ConsumeRequest{Offset: 0}); err == nil {
+		t.Fatal("consume read from the leader")
+	}
+}
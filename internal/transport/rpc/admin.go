@@ -0,0 +1,240 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/auth"
+	"logger/internal/service/discovery"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var _ v1.AdminServer = (*AdminServer)(nil)
+
+// Keyring manages the gossip encryption keys of the cluster.
+type Keyring interface {
+	InstallKey(key string) (*serf.KeyResponse, error)
+	UseKey(key string) (*serf.KeyResponse, error)
+	RemoveKey(key string) (*serf.KeyResponse, error)
+	ListKeys() (*serf.KeyResponse, error)
+}
+
+// Commands sends cluster-wide commands to every member.
+type Commands interface {
+	Broadcast(name string, args []byte, wait bool, timeout time.Duration) ([]discovery.CommandResult, error)
+}
+
+// Policy manages the acl policy.
+type Policy interface {
+	Version() auth.Version
+	AddPolicy(ptype string, rule []string) (uint64, error)
+	RemovePolicy(ptype string, rule []string) (uint64, error)
+	Policies() map[string][][]string
+}
+
+// AdminServer serves the operations of the cluster administrators.
+type AdminServer struct {
+	v1.UnimplementedAdminServer
+	*Config
+
+	drain *drainer
+}
+
+func (self *AdminServer) InstallKey(ctx context.Context, req *v1.KeyRequest) (*v1.KeyResponse, error) {
+	if err := self.authorizeKeyring(ctx); err != nil {
+		return nil, err
+	}
+
+	return keyResponse(self.Keyring.InstallKey(req.Key))
+}
+
+func (self *AdminServer) UseKey(ctx context.Context, req *v1.KeyRequest) (*v1.KeyResponse, error) {
+	if err := self.authorizeKeyring(ctx); err != nil {
+		return nil, err
+	}
+
+	return keyResponse(self.Keyring.UseKey(req.Key))
+}
+
+func (self *AdminServer) RemoveKey(ctx context.Context, req *v1.KeyRequest) (*v1.KeyResponse, error) {
+	if err := self.authorizeKeyring(ctx); err != nil {
+		return nil, err
+	}
+
+	return keyResponse(self.Keyring.RemoveKey(req.Key))
+}
+
+func (self *AdminServer) ListKeys(ctx context.Context, req *v1.ListKeysRequest) (*v1.KeyResponse, error) {
+	if err := self.authorizeKeyring(ctx); err != nil {
+		return nil, err
+	}
+
+	return keyResponse(self.Keyring.ListKeys())
+}
+
+// authorizeKeyring checks the admin permission
+// and that the keyring is configured.
+func (self *AdminServer) authorizeKeyring(ctx context.Context) error {
+	err := self.authorize(ctx, keyringObject, adminAction)
+	if err != nil {
+		return err
+	}
+
+	if self.Keyring == nil {
+		return status.Error(codes.Unavailable, "gossip keyring is not configured")
+	}
+
+	return nil
+}
+
+// keyResponse converts the response of a keyring operation.
+// Failures of single nodes are reported in the response.
+func keyResponse(res *serf.KeyResponse, err error) (*v1.KeyResponse, error) {
+	if err != nil && res == nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if res == nil {
+		return nil, status.Error(codes.Internal, "keyring returned no response")
+	}
+
+	out := &v1.KeyResponse{
+		NumNodes:    int32(res.NumNodes),
+		NumResp:     int32(res.NumResp),
+		NumErr:      int32(res.NumErr),
+		Messages:    res.Messages,
+		Keys:        make(map[string]int32, len(res.Keys)),
+		PrimaryKeys: make(map[string]int32, len(res.PrimaryKeys)),
+	}
+	for k, n := range res.Keys {
+		out.Keys[k] = int32(n)
+	}
+	for k, n := range res.PrimaryKeys {
+		out.PrimaryKeys[k] = int32(n)
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+
+	return out, nil
+}
+
+// Broadcast executes a command on every member of the cluster.
+func (self *AdminServer) Broadcast(ctx context.Context, req *v1.BroadcastRequest) (*v1.BroadcastResponse, error) {
+	err := self.authorize(ctx, clusterObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Commands == nil {
+		return nil, status.Error(codes.Unavailable, "discovery is not configured")
+	}
+
+	results, err := self.Commands.Broadcast(
+		req.Name,
+		req.Args,
+		!req.NoWait,
+		req.Timeout.AsDuration(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.BroadcastResponse{}
+	for _, r := range results {
+		res.Results = append(res.Results, &v1.CommandResult{
+			Node:   r.Node,
+			Output: r.Output,
+			Error:  r.Error,
+		})
+	}
+
+	return res, nil
+}
+
+// PolicyVersion returns the version of the acl policy loaded by the node.
+func (self *AdminServer) PolicyVersion(ctx context.Context, req *v1.PolicyVersionRequest) (*v1.PolicyVersionResponse, error) {
+	err := self.authorize(ctx, aclObject, describeAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Policy == nil {
+		return nil, errNoPolicy
+	}
+
+	v := self.Policy.Version()
+	return &v1.PolicyVersionResponse{
+		Version:   v.Number,
+		LoadedAt:  timestamppb.New(v.LoadedAt),
+		Checksum:  v.Checksum,
+		LastError: v.LastError,
+	}, nil
+}
+
+// AddPolicy adds a rule to the acl policy of every node.
+func (self *AdminServer) AddPolicy(ctx context.Context, req *v1.PolicyRequest) (*v1.PolicyResponse, error) {
+	if err := self.authorizePolicy(ctx, adminAction); err != nil {
+		return nil, err
+	}
+
+	off, err := self.Policy.AddPolicy(req.Rule.GetType(), req.Rule.GetRule())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.PolicyResponse{Offset: off}, nil
+}
+
+// RemovePolicy removes a rule from the acl policy of every node.
+func (self *AdminServer) RemovePolicy(ctx context.Context, req *v1.PolicyRequest) (*v1.PolicyResponse, error) {
+	if err := self.authorizePolicy(ctx, adminAction); err != nil {
+		return nil, err
+	}
+
+	off, err := self.Policy.RemovePolicy(req.Rule.GetType(), req.Rule.GetRule())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.PolicyResponse{Offset: off}, nil
+}
+
+// ListPolicies lists the rules of the acl policy in effect.
+func (self *AdminServer) ListPolicies(ctx context.Context, req *v1.ListPoliciesRequest) (*v1.ListPoliciesResponse, error) {
+	if err := self.authorizePolicy(ctx, describeAction); err != nil {
+		return nil, err
+	}
+
+	rules := self.Policy.Policies()
+
+	res := &v1.ListPoliciesResponse{}
+	for _, ptype := range []string{auth.PolicyType, auth.GroupingType, auth.QuotaType} {
+		for _, rule := range rules[ptype] {
+			res.Rules = append(res.Rules, &v1.PolicyRule{Type: ptype, Rule: rule})
+		}
+	}
+
+	return res, nil
+}
+
+// errNoPolicy is returned when the policy can't be managed
+var errNoPolicy = status.Error(codes.Unavailable, "acl policy is not managed")
+
+// authorizePolicy checks the permission on the acl
+// and that the policy is configured.
+func (self *AdminServer) authorizePolicy(ctx context.Context, action string) error {
+	err := self.authorize(ctx, aclObject, action)
+	if err != nil {
+		return err
+	}
+
+	if self.Policy == nil {
+		return errNoPolicy
+	}
+
+	return nil
+}
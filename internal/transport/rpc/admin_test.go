@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/serf/serf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestKeyResponse(t *testing.T) {
+	failed := errors.New("1/3 nodes reported failure")
+
+	tests := []struct {
+		name      string
+		res       *serf.KeyResponse
+		err       error
+		wantCode  codes.Code
+		wantError string
+	}{
+		{
+			name: "response",
+			res:  &serf.KeyResponse{NumNodes: 3, NumResp: 3, Keys: map[string]int{"k": 3}},
+		},
+		{
+			name:      "failures of single nodes",
+			res:       &serf.KeyResponse{NumNodes: 3, NumResp: 3, NumErr: 1},
+			err:       failed,
+			wantError: failed.Error(),
+		},
+		{
+			name:     "error without response",
+			err:      failed,
+			wantCode: codes.Internal,
+		},
+		{
+			name:     "no response",
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := keyResponse(tt.res, tt.err)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("got %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+
+			if out.Error != tt.wantError {
+				t.Fatalf("got error %q, want %q", out.Error, tt.wantError)
+			}
+			if int(out.NumNodes) != tt.res.NumNodes || len(out.Keys) != len(tt.res.Keys) {
+				t.Fatalf("got %+v from %+v", out, tt.res)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/audit"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// auditObject is readable only by the auditors
+	auditObject = "audit"
+	readAction  = "read"
+	callAction  = "call"
+)
+
+// adminMethodPrefix is the prefix of the admin calls
+var adminMethodPrefix = "/" + v1.Admin_ServiceDesc.ServiceName + "/"
+
+// Auditor records the authorization decisions and the admin calls.
+type Auditor interface {
+	Record(event audit.Event)
+	Read(offset uint64, max int) ([]audit.Event, uint64, error)
+}
+
+// authorize checks the permission of the subject of the call
+// and records the decision in the audit log.
+func (self *Config) authorize(ctx context.Context, object, action string) error {
+	err := self.Authorize.Authorize(subject(ctx), object, action)
+
+	if self.Audit != nil {
+		self.Audit.Record(callEvent(ctx, object, action, err))
+	}
+
+	return err
+}
+
+// authorizeTopics checks the subject may do the action on at least
+// one topic, before the topics of the records are known.
+func (self *Config) authorizeTopics(ctx context.Context, action string) error {
+	object := topicObject("*")
+
+	var err error
+	if authorizer, ok := self.Authorize.(AnyAuthorizer); ok {
+		err = authorizer.AuthorizeAny(subject(ctx), topicObjectPrefix, action)
+	} else {
+		err = self.Authorize.Authorize(subject(ctx), object, action)
+	}
+
+	if self.Audit != nil {
+		self.Audit.Record(callEvent(ctx, object, action, err))
+	}
+
+	return err
+}
+
+// auditAdmin records every call of the Admin service with its outcome.
+func (self *Config) auditAdmin(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	res, err := handler(ctx, req)
+
+	if self.Audit != nil && strings.HasPrefix(info.FullMethod, adminMethodPrefix) {
+		self.Audit.Record(callEvent(ctx, adminObject(info.FullMethod), callAction, err))
+	}
+
+	return res, err
+}
+
+// ReadAudit returns the events of the audit log from the offset.
+func (self *AdminServer) ReadAudit(ctx context.Context, req *v1.ReadAuditRequest) (*v1.ReadAuditResponse, error) {
+	err := self.authorize(ctx, auditObject, readAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Audit == nil {
+		return nil, status.Error(codes.Unavailable, "audit log is not configured")
+	}
+
+	events, next, err := self.Audit.Read(req.Offset, int(req.MaxEvents))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.ReadAuditResponse{NextOffset: next}
+	for _, e := range events {
+		res.Events = append(res.Events, &v1.AuditEvent{
+			Time:     timestamppb.New(e.Time),
+			Subject:  e.Subject,
+			Action:   e.Action,
+			Object:   e.Object,
+			Peer:     e.Peer,
+			Method:   e.Method,
+			Decision: e.Decision,
+			Error:    e.Error,
+		})
+	}
+
+	return res, nil
+}
+
+// callEvent returns the audit event of the call with its outcome.
+func callEvent(ctx context.Context, object, action string, err error) audit.Event {
+	event := audit.Event{
+		Subject:  subject(ctx),
+		Action:   action,
+		Object:   object,
+		Decision: audit.Allow,
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		event.Peer = p.Addr.String()
+	}
+	if method, ok := grpc.Method(ctx); ok {
+		event.Method = method
+	}
+
+	switch {
+	case err == nil:
+	case status.Code(err) == codes.PermissionDenied:
+		event.Decision = audit.Deny
+	default:
+		event.Decision = audit.Error
+		event.Error = err.Error()
+	}
+
+	return event
+}
+
+// adminObject returns the object of an admin call, e.g. admin/Drain.
+func adminObject(method string) string {
+	return "admin/" + strings.TrimPrefix(method, adminMethodPrefix)
+}
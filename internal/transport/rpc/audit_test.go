@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/audit"
+	"logger/internal/service/auth"
+	"logger/internal/service/authn"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// events keeps the audit events in memory.
+type events struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (self *events) Record(event audit.Event) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.events = append(self.events, event)
+}
+
+func (self *events) Read(offset uint64, max int) ([]audit.Event, uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	end := uint64(len(self.events))
+	if max > 0 {
+		end = min(end, offset+uint64(max))
+	}
+	if offset > end {
+		offset = end
+	}
+	return append([]audit.Event(nil), self.events[offset:end]...), end, nil
+}
+
+func TestOnlyAuditorsReadTheAuditLog(t *testing.T) {
+	authorizer, err := auth.New("../../../test/model.conf", "../../../test/policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := &events{}
+	server, err := New(&Config{
+		CommitLog:      &memLog{},
+		Authorize:      authorizer,
+		Authenticators: []authn.Authenticator{claimed{}},
+		Audit:          log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	defer server.Stop()
+
+	cc, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := v1.NewAdminClient(cc)
+
+	tests := []struct {
+		subject string
+		want    codes.Code
+	}{
+		{"auditor", codes.OK},
+		// the admins can't read what they did
+		{"root", codes.PermissionDenied},
+		{"admin", codes.PermissionDenied},
+		{"producer", codes.PermissionDenied},
+		{"nobody", codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			_, err := client.ReadAudit(as(tt.subject), &v1.ReadAuditRequest{})
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("got %s, want %s: %v", got, tt.want, err)
+			}
+		})
+	}
+
+	// every attempt is recorded
+	res, err := client.ReadAudit(as("auditor"), &v1.ReadAuditRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denied := 0
+	for _, e := range res.Events {
+		if e.Object == auditObject && e.Action == readAction && e.Decision == audit.Deny {
+			denied++
+		}
+	}
+	if denied != 4 {
+		t.Fatalf("got %d denied reads in %v, want 4", denied, res.Events)
+	}
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// pollInterval is how often the log is checked for new records
+const pollInterval = 10 * time.Millisecond
+
+// ConsumeBatchStream streams batches of records starting from the
+// requested offset. A batch is sent when it reaches max records or
+// max bytes, or when the log has no more records and max wait elapsed.
+// Records of topics the subject can't consume are skipped, the subject
+// must be able to consume at least one topic.
+func (self *GRPCServer) ConsumeBatchStream(
+	req *v1.ConsumeRequest,
+	stream v1.Log_ConsumeBatchStreamServer,
+) error {
+	ctx := stream.Context()
+
+	err := self.authorizeTopics(ctx, consumeAction)
+	if err != nil {
+		return err
+	}
+
+	offset := req.Offset
+	id := self.drain.open(offset)
+	defer self.drain.close(id)
+
+	for {
+		records, next, err := self.batch(ctx, offset, req)
+		if err != nil {
+			return err
+		}
+
+		// the stream is done
+		if records == nil {
+			return nil
+		}
+
+		// the next offset tells an empty log from one with a record
+		watermark, err := nextOffset(self.CommitLog)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&v1.ConsumeBatchResponse{
+			Records:       records,
+			HighWatermark: watermark,
+		})
+		if err != nil {
+			return err
+		}
+
+		// the skipped records are passed as well
+		offset = next
+		self.drain.progress(id, offset)
+	}
+}
+
+// batch reads records from the offset until a limit of the request
+// is reached and returns them with the offset to read next.
+// It returns nil when the context is done.
+func (self *GRPCServer) batch(
+	ctx context.Context,
+	offset uint64,
+	req *v1.ConsumeRequest,
+) ([]*v1.Record, uint64, error) {
+	var (
+		records []*v1.Record
+		size    uint64
+	)
+
+	deadline := time.Now().Add(req.MaxWait.AsDuration())
+	for {
+		if req.MaxRecords > 0 && len(records) >= int(req.MaxRecords) {
+			return records, offset, nil
+		}
+
+		record, err := self.CommitLog.Read(offset)
+		switch err.(type) {
+		case nil:
+			err = self.authorize(
+				ctx,
+				topicObject(record.Topic),
+				topicAction(record.Topic, consumeAction),
+			)
+			if status.Code(err) == codes.PermissionDenied {
+				offset++
+				continue
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+
+			n := uint64(proto.Size(record))
+
+			// a batch always holds at least one record
+			if req.MaxBytes > 0 && len(records) > 0 && size+n > req.MaxBytes {
+				return records, offset, nil
+			}
+
+			records = append(records, record)
+			size += n
+			offset++
+			continue
+		case ErrOffsetOutOfRange:
+		default:
+			return nil, 0, err
+		}
+
+		// the log has no more records for now
+		if len(records) > 0 && !time.Now().Before(deadline) {
+			return records, offset, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
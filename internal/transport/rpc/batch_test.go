@@ -0,0 +1,196 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/authn"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// grants lets the subjects do everything on the granted objects only.
+type grants map[string]bool
+
+func (self grants) Authorize(subject, object, action string) error {
+	if self[object] {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "%s can't %s %s", subject, action, object)
+}
+
+func (self grants) AuthorizeAny(subject, prefix, action string) error {
+	for object := range self {
+		if strings.HasPrefix(object, prefix) {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "%s can't %s %s*", subject, action, prefix)
+}
+
+// startServer serves the log and returns a client of the server.
+func startServer(t *testing.T, log CommitLog, authorizer Authorizer) v1.LogClient {
+	t.Helper()
+
+	server, err := New(&Config{
+		CommitLog:      log,
+		Authorize:      authorizer,
+		Authenticators: []authn.Authenticator{anonymous{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	return v1.NewLogClient(cc)
+}
+
+// consumeBatches returns the offsets of the batches received until
+// the stream has been idle for a while, and the last high watermark.
+func consumeBatches(t *testing.T, client v1.LogClient, req *v1.ConsumeRequest) ([][]uint64, uint64) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	stream, err := client.ConsumeBatchStream(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var batches [][]uint64
+	var watermark uint64
+	for {
+		res, err := stream.Recv()
+		if status.Code(err) == codes.DeadlineExceeded || err == io.EOF {
+			return batches, watermark
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var offsets []uint64
+		for _, r := range res.Records {
+			offsets = append(offsets, r.Offset)
+		}
+		batches = append(batches, offsets)
+		watermark = res.HighWatermark
+	}
+}
+
+func TestConsumeBatchStream(t *testing.T) {
+	record := &v1.Record{Topic: "orders", Value: []byte("hello")}
+	size := uint64(proto.Size(&v1.Record{Topic: "orders", Value: []byte("hello"), Offset: 1}))
+
+	tests := []struct {
+		name    string
+		records int
+		req     *v1.ConsumeRequest
+		want    [][]uint64
+	}{
+		{
+			name:    "max records",
+			records: 5,
+			req:     &v1.ConsumeRequest{MaxRecords: 2},
+			want:    [][]uint64{{0, 1}, {2, 3}, {4}},
+		},
+		{
+			name:    "max bytes",
+			records: 5,
+			req:     &v1.ConsumeRequest{MaxBytes: 2 * size},
+			want:    [][]uint64{{0, 1}, {2, 3}, {4}},
+		},
+		{
+			name:    "from an offset",
+			records: 3,
+			req:     &v1.ConsumeRequest{Offset: 1, MaxRecords: 10},
+			want:    [][]uint64{{1, 2}},
+		},
+		{
+			name:    "a single record",
+			records: 1,
+			req:     &v1.ConsumeRequest{MaxRecords: 10},
+			want:    [][]uint64{{0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &memLog{}
+			for i := 0; i < tt.records; i++ {
+				if _, err := log.Append(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			client := startServer(t, log, allow{})
+
+			tt.req.MaxWait = durationpb.New(20 * time.Millisecond)
+			batches, watermark := consumeBatches(t, client, tt.req)
+
+			if got, want := fmt.Sprint(batches), fmt.Sprint(tt.want); got != want {
+				t.Fatalf("got batches %s, want %s", got, want)
+			}
+			// the next offset, so one record isn't mistaken for none
+			if watermark != uint64(tt.records) {
+				t.Fatalf("got high watermark %d, want %d", watermark, tt.records)
+			}
+		})
+	}
+}
+
+func TestConsumeBatchStreamSkipsDeniedTopics(t *testing.T) {
+	log := &memLog{}
+	for _, topic := range []string{"orders", "payments", "orders"} {
+		if _, err := log.Append(&v1.Record{Topic: topic, Value: []byte("hello")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := startServer(t, log, grants{topicObject("orders"): true})
+
+	batches, _ := consumeBatches(t, client, &v1.ConsumeRequest{
+		MaxRecords: 10,
+		MaxWait:    durationpb.New(20 * time.Millisecond),
+	})
+	if got := fmt.Sprint(batches); got != "[[0 2]]" {
+		t.Fatalf("got batches %s, want [[0 2]]", got)
+	}
+}
+
+func TestConsumeBatchStreamWithoutGrants(t *testing.T) {
+	log := &memLog{}
+	if _, err := log.Append(&v1.Record{Topic: "orders", Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	client := startServer(t, log, grants{})
+
+	stream, err := client.ConsumeBatchStream(context.Background(), &v1.ConsumeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("got %v, want PermissionDenied", err)
+	}
+}
@@ -0,0 +1,260 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/discovery"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	rpcAddrTag    = "rpc_addr"
+	statusTimeout = 5 * time.Second
+)
+
+// ClusterStatus lists every member known to discovery
+// with its highest offset and replication lag.
+func (self *GRPCServer) ClusterStatus(
+	ctx context.Context,
+	req *v1.ClusterStatusRequest,
+) (*v1.ClusterStatusResponse, error) {
+	err := self.authorize(
+		ctx,
+		clusterObject,
+		describeAction,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := self.localStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Local || self.Cluster == nil {
+		return &v1.ClusterStatusResponse{Members: []*v1.Member{local}}, nil
+	}
+
+	// ask every other member for its own status
+	members := []*v1.Member{local}
+	for _, m := range self.Cluster.Members() {
+		if m.Name == local.Name {
+			continue
+		}
+		members = append(members, self.remoteStatus(ctx, m))
+	}
+
+	lag(members)
+
+	return &v1.ClusterStatusResponse{Members: members}, nil
+}
+
+// localStatus returns the status of the local node.
+func (self *GRPCServer) localStatus() (*v1.Member, error) {
+	highest, err := self.CommitLog.HighestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := nextOffset(self.CommitLog)
+	if err != nil {
+		return nil, err
+	}
+
+	member := &v1.Member{
+		HighestOffset: highest,
+		NextOffset:    next,
+		Local:         true,
+	}
+
+	if self.Cluster != nil {
+		m := self.Cluster.LocalMember()
+		member.Name = m.Name
+		member.Status = m.Status.String()
+		member.Tags = m.Tags
+		member.RpcAddr = m.Tags[rpcAddrTag]
+	}
+
+	if self.Replication != nil {
+		for _, p := range self.Replication.Peers() {
+			member.Replication = append(member.Replication, &v1.Replication{
+				Source:     p.Name,
+				RpcAddr:    p.Addr,
+				NextOffset: p.NextOffset,
+			})
+		}
+	}
+
+	return member, nil
+}
+
+// remoteStatus asks a member for its local status.
+// Errors are reported in the member instead of failing the request.
+func (self *Config) remoteStatus(ctx context.Context, m serf.Member) *v1.Member {
+	member := &v1.Member{
+		Name:    m.Name,
+		Status:  m.Status.String(),
+		Tags:    m.Tags,
+		RpcAddr: m.Tags[rpcAddrTag],
+	}
+
+	// failed and left members can't answer
+	if m.Status != serf.StatusAlive || member.RpcAddr == "" {
+		return member
+	}
+
+	cc, err := grpc.NewClient(member.RpcAddr, self.DialOptions...)
+	if err != nil {
+		member.Error = err.Error()
+		return member
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+	defer cancel()
+
+	res, err := v1.NewLogClient(cc).ClusterStatus(
+		ctx,
+		&v1.ClusterStatusRequest{Local: true},
+	)
+	if err == nil && len(res.Members) == 0 {
+		err = status.Error(codes.Internal, "empty cluster status")
+	}
+	if err != nil {
+		member.Error = err.Error()
+		return member
+	}
+
+	member.HighestOffset = res.Members[0].HighestOffset
+	member.NextOffset = res.Members[0].NextOffset
+	member.Replication = res.Members[0].Replication
+
+	return member
+}
+
+// lag fills in the replication lag of every member
+// relative to the next offset of each source, so an
+// empty source log has no lag.
+func lag(members []*v1.Member) {
+	sources := make(map[string]*v1.Member, len(members))
+	for _, m := range members {
+		if m.Error == "" && m.Status == serf.StatusAlive.String() {
+			sources[m.Name] = m
+		}
+	}
+
+	for _, m := range members {
+		for _, r := range m.Replication {
+			source, ok := sources[r.Source]
+			if !ok {
+				continue
+			}
+
+			r.SourceHighestOffset = source.HighestOffset
+			if source.NextOffset > r.NextOffset {
+				r.Lag = source.NextOffset - r.NextOffset
+			}
+		}
+	}
+}
+
+// GetServers returns the alive members with their rpc address.
+// It is used by clients to discover the cluster, so any
+// authenticated subject is allowed to call it.
+func (self *GRPCServer) GetServers(
+	ctx context.Context,
+	req *v1.GetServersRequest,
+) (*v1.GetServersResponse, error) {
+	if self.Cluster == nil {
+		return nil, status.Error(codes.Unavailable, "discovery is not configured")
+	}
+
+	return &v1.GetServersResponse{Servers: self.servers()}, nil
+}
+
+// WatchServers sends the servers, then sends them again
+// every time the membership changes them.
+func (self *GRPCServer) WatchServers(
+	req *v1.GetServersRequest,
+	stream v1.Log_WatchServersServer,
+) error {
+	if self.Cluster == nil {
+		return status.Error(codes.Unavailable, "discovery is not configured")
+	}
+
+	changes, stop := self.Cluster.Watch()
+	defer stop()
+
+	var last []*v1.Server
+	for {
+		servers := self.servers()
+		if last == nil || !sameServers(last, servers) {
+			err := stream.Send(&v1.GetServersResponse{Servers: servers})
+			if err != nil {
+				return err
+			}
+			last = servers
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-changes:
+		}
+	}
+}
+
+// servers returns the alive members that serve clients.
+func (self *GRPCServer) servers() []*v1.Server {
+	servers := []*v1.Server{}
+	for _, m := range self.Cluster.Members() {
+		addr := m.Tags[rpcAddrTag]
+		if m.Status != serf.StatusAlive || addr == "" {
+			continue
+		}
+
+		// draining servers are about to leave
+		if discovery.NodeFromMember(m).Draining {
+			continue
+		}
+
+		servers = append(servers, &v1.Server{
+			Id:      m.Name,
+			RpcAddr: addr,
+		})
+	}
+
+	// the leader is the server with the lowest name,
+	// so every node elects the same one from the same members
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Id < servers[j].Id
+	})
+	if len(servers) > 0 {
+		servers[0].IsLeader = true
+	}
+
+	return servers
+}
+
+// sameServers reports whether two sorted lists hold the same servers.
+func sameServers(a, b []*v1.Server) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !proto.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
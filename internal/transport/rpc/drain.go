@@ -0,0 +1,222 @@
+package rpc
+
+import (
+	"context"
+	"log"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/discovery"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	drainTimeout      = time.Minute
+	drainPollInterval = 100 * time.Millisecond
+)
+
+// Membership publishes the descriptor of the local node.
+type Membership interface {
+	Update(update func(node *discovery.Node)) error
+	Leave() error
+}
+
+// drainer holds the drain state shared by the servers
+// and the offsets of the open consume streams.
+type drainer struct {
+	draining atomic.Bool
+
+	mu      sync.Mutex
+	lastID  uint64
+	streams map[uint64]uint64
+}
+
+// open registers a consume stream at its next offset.
+func (self *drainer) open(next uint64) uint64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.streams == nil {
+		self.streams = make(map[uint64]uint64)
+	}
+
+	self.lastID++
+	self.streams[self.lastID] = next
+
+	return self.lastID
+}
+
+// progress stores the next offset of a consume stream.
+func (self *drainer) progress(id, next uint64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.streams[id] = next
+}
+
+// close removes a consume stream.
+func (self *drainer) close(id uint64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delete(self.streams, id)
+}
+
+// behind returns the number of streams that didn't reach the offset.
+func (self *drainer) behind(next uint64) uint32 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var n uint32
+	for _, off := range self.streams {
+		if off < next {
+			n++
+		}
+	}
+
+	return n
+}
+
+// errDraining is returned to producers of a draining node
+var errDraining = status.Error(codes.Unavailable, "node is draining")
+
+// replicating reports whether the call is made by the local replicator.
+func (self *Config) replicating(ctx context.Context) bool {
+	return self.ReplicatorSubject != "" && subject(ctx) == self.ReplicatorSubject
+}
+
+// Drain stops accepting new records, publishes the draining tag,
+// waits for the consumers and replicas to catch up and leaves the cluster.
+// The node accepts records again when it doesn't leave.
+func (self *AdminServer) Drain(ctx context.Context, req *v1.DrainRequest) (res *v1.DrainResponse, err error) {
+	err = self.authorize(ctx, clusterObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Cluster == nil || self.Membership == nil {
+		return nil, status.Error(codes.Unavailable, "discovery is not configured")
+	}
+
+	defer func() {
+		if res != nil && res.Left {
+			return
+		}
+
+		err := self.setDraining(false)
+		if err != nil {
+			log.Printf("[ERROR] golog: failed to publish the end of the drain: %s", err)
+		}
+	}()
+
+	err = self.setDraining(true)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := drainTimeout
+	if req.Timeout != nil {
+		timeout = req.Timeout.AsDuration()
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		res, err = self.progress(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.CaughtUp || !time.Now().Before(deadline) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(drainPollInterval):
+		}
+	}
+
+	if !res.CaughtUp && !req.Force {
+		return res, nil
+	}
+
+	err = self.Membership.Leave()
+	if err != nil {
+		return nil, err
+	}
+	res.Left = true
+
+	return res, nil
+}
+
+// setDraining switches the node in and out of the draining state,
+// for producers, health checks and the other nodes.
+func (self *AdminServer) setDraining(draining bool) error {
+	self.drain.draining.Store(draining)
+	self.health.setDraining(draining)
+
+	return self.Membership.Update(func(node *discovery.Node) {
+		node.Draining = draining
+	})
+}
+
+// progress reports how far the consumers and replicas are.
+func (self *AdminServer) progress(ctx context.Context) (*v1.DrainResponse, error) {
+	next, err := nextOffset(self.CommitLog)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.DrainResponse{
+		NextOffset:      next,
+		ConsumersBehind: self.drain.behind(next),
+	}
+
+	local := self.Cluster.LocalMember().Name
+	res.CaughtUp = res.ConsumersBehind == 0
+	for _, m := range self.Cluster.Members() {
+		if m.Name == local || m.Status != serf.StatusAlive {
+			continue
+		}
+
+		replica := &v1.ReplicaProgress{
+			Name:    m.Name,
+			RpcAddr: m.Tags[rpcAddrTag],
+		}
+
+		member := self.remoteStatus(ctx, m)
+		replica.Error = member.Error
+		for _, r := range member.Replication {
+			if r.Source == local {
+				replica.NextOffset = r.NextOffset
+			}
+		}
+
+		replica.CaughtUp = replica.Error == "" && replica.NextOffset >= next
+		res.CaughtUp = res.CaughtUp && replica.CaughtUp
+		res.SafeToRemove = res.SafeToRemove || replica.CaughtUp
+		res.Replicas = append(res.Replicas, replica)
+	}
+
+	return res, nil
+}
+
+// nextOffset returns the offset of the next record of the log.
+func nextOffset(log CommitLog) (uint64, error) {
+	highest, err := log.HighestOffset()
+	if err != nil {
+		return 0, err
+	}
+
+	// the highest offset of an empty log is zero as well
+	if _, err := log.Read(highest); err != nil {
+		return 0, nil
+	}
+
+	return highest + 1, nil
+}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/authn"
+	"logger/internal/service/discovery"
+
+	"github.com/hashicorp/serf/serf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// claimed authenticates the calls as the subject they claim.
+type claimed struct{}
+
+func (claimed) Authenticate(ctx context.Context) (string, error) {
+	if values := metadata.ValueFromIncomingContext(ctx, "subject"); len(values) > 0 {
+		return values[0], nil
+	}
+	return "", status.Error(codes.Unauthenticated, "no subject")
+}
+
+// as returns a context of calls made by the subject.
+func as(subject string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "subject", subject)
+}
+
+// membership records the updates of the local node.
+type membership struct {
+	mu   sync.Mutex
+	node discovery.Node
+	left bool
+}
+
+func (self *membership) Update(update func(node *discovery.Node)) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	update(&self.node)
+	return nil
+}
+
+func (self *membership) Leave() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.left = true
+	return nil
+}
+
+func TestDrainKeepsReplicating(t *testing.T) {
+	m := &membership{}
+	server, err := New(&Config{
+		CommitLog:         &memLog{},
+		Authorize:         allow{},
+		Authenticators:    []authn.Authenticator{claimed{}},
+		Cluster:           &cluster{status: serf.StatusAlive, changes: make(chan struct{})},
+		Membership:        m,
+		ReplicatorSubject: "replicator",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	defer server.Stop()
+
+	cc, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	// no consumer nor replica is behind, the node leaves
+	res, err := v1.NewAdminClient(cc).Drain(as("admin"), &v1.DrainRequest{
+		Timeout: durationpb.New(time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Left || !m.left || !m.node.Draining {
+		t.Fatalf("got %+v, left %v, draining %v, want a drained node", res, m.left, m.node.Draining)
+	}
+
+	client := v1.NewLogClient(cc)
+	record := &v1.Record{Topic: "orders", Value: []byte("hello")}
+
+	_, err = client.Produce(as("client"), &v1.ProduceRequest{Record: record})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want %v", err, errDraining)
+	}
+
+	// the records of the other nodes are still replicated
+	_, err = client.Produce(as("replicator"), &v1.ProduceRequest{Record: record})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,319 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	v1 "logger/gen/go/v1"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+/*
+The gateway serves produce and consume over HTTP/JSON for the clients
+that can't speak gRPC. A request is turned into the context of a gRPC
+call, with the client certificate as the peer and the authorization
+and x-api-key headers as metadata, then goes through the same
+authenticators, quotas and Log service as a gRPC call would.
+
+	POST /v1/records           produce a record, or one per line of an
+	                           application/x-ndjson body
+	GET  /v1/records/{offset}  consume the record at the offset
+	GET  /v1/offsets           lowest, highest and next offset of the log
+
+Values are base64 in the JSON, like the bytes of the protobuf JSON
+mapping, so binary records go through unchanged. The topic of the
+records without one is taken from the topic query parameter. A body
+is limited to the default max message size of a gRPC server.
+*/
+
+// ndjsonContentType marks a body of records, one per line
+const ndjsonContentType = "application/x-ndjson"
+
+// maxBodyBytes is the default max receive message size of gRPC
+const maxBodyBytes = 4 << 20
+
+// gatewayRecord is the JSON form of a record
+type gatewayRecord struct {
+	Offset uint64 `json:"offset"`
+	Topic  string `json:"topic,omitempty"`
+	Value  []byte `json:"value"`
+}
+
+// gatewayError is the body of the failed requests
+type gatewayError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	// offsets of the records produced before a batch failed
+	Offsets []uint64 `json:"offsets,omitempty"`
+}
+
+type gateway struct {
+	config *Config
+}
+
+// NewGateway returns the handler of the HTTP/JSON gateway.
+// The config must have been passed to New before.
+func NewGateway(config *Config) http.Handler {
+	g := &gateway{config: config}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/records", g.produce).Methods(http.MethodPost)
+	r.HandleFunc("/v1/records/{offset:[0-9]+}", g.consume).Methods(http.MethodGet)
+	r.HandleFunc("/v1/offsets", g.offsets).Methods(http.MethodGet)
+
+	return r
+}
+
+// produce appends the records of the body.
+func (self *gateway) produce(w http.ResponseWriter, r *http.Request) {
+	ctx, err := self.context(r)
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+
+	batch := strings.HasPrefix(r.Header.Get("Content-Type"), ndjsonContentType)
+	topic := r.URL.Query().Get("topic")
+
+	offsets := []uint64{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	for {
+		var record gatewayRecord
+		err := dec.Decode(&record)
+		if errors.Is(err, io.EOF) && (batch || len(offsets) > 0) {
+			break
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			self.json(w, http.StatusRequestEntityTooLarge, gatewayError{
+				Error:   fmt.Sprintf("body larger than %d bytes", tooLarge.Limit),
+				Code:    codes.ResourceExhausted.String(),
+				Offsets: offsets,
+			})
+			return
+		}
+		if err != nil {
+			self.error(w, status.Errorf(codes.InvalidArgument, "invalid record: %s", err), offsets)
+			return
+		}
+
+		if record.Topic == "" {
+			record.Topic = topic
+		}
+
+		res, err := self.invoke(ctx, v1.Log_Produce_FullMethodName, &v1.ProduceRequest{
+			Record: &v1.Record{Topic: record.Topic, Value: record.Value},
+		})
+		if err != nil {
+			self.error(w, err, offsets)
+			return
+		}
+		offsets = append(offsets, res.(*v1.ProduceResponse).Offset)
+
+		if !batch {
+			break
+		}
+	}
+
+	if batch {
+		self.json(w, http.StatusOK, map[string][]uint64{"offsets": offsets})
+		return
+	}
+	self.json(w, http.StatusOK, map[string]uint64{"offset": offsets[0]})
+}
+
+// consume returns the record at the offset.
+func (self *gateway) consume(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.ParseUint(mux.Vars(r)["offset"], 10, 64)
+	if err != nil {
+		self.error(w, status.Errorf(codes.InvalidArgument, "invalid offset: %s", err), nil)
+		return
+	}
+
+	ctx, err := self.context(r)
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+
+	res, err := self.invoke(ctx, v1.Log_Consume_FullMethodName, &v1.ConsumeRequest{Offset: offset})
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+
+	record := res.(*v1.ConsumeResponse).Record
+	self.json(w, http.StatusOK, gatewayRecord{
+		Offset: record.Offset,
+		Topic:  record.Topic,
+		Value:  record.Value,
+	})
+}
+
+// offsets returns the range of offsets of the log.
+func (self *gateway) offsets(w http.ResponseWriter, r *http.Request) {
+	ctx, err := self.context(r)
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+
+	err = self.config.authorize(ctx, logObject, describeAction)
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+
+	lowest, err := self.config.CommitLog.LowestOffset()
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+	highest, err := self.config.CommitLog.HighestOffset()
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+	next, err := nextOffset(self.config.CommitLog)
+	if err != nil {
+		self.error(w, err, nil)
+		return
+	}
+
+	self.json(w, http.StatusOK, map[string]uint64{
+		"lowest_offset":  lowest,
+		"highest_offset": highest,
+		"next_offset":    next,
+	})
+}
+
+// context returns the context of a gRPC call made with the
+// credentials of the request, authenticated by the authenticators.
+func (self *gateway) context(r *http.Request) (context.Context, error) {
+	p := &peer.Peer{Addr: remoteAddr(r.RemoteAddr)}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+	}
+
+	md := metadata.MD{}
+	for _, header := range []string{"authorization", "x-api-key"} {
+		if values := r.Header.Values(header); len(values) > 0 {
+			md.Set(header, values...)
+		}
+	}
+
+	ctx := peer.NewContext(r.Context(), p)
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	return self.config.authenticate(ctx)
+}
+
+// invoke calls a method of the Log service through the quotas.
+func (self *gateway) invoke(ctx context.Context, method string, req any) (any, error) {
+	srv := self.config.server
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: method}
+
+	return self.config.quotaUnary(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+		switch req := req.(type) {
+		case *v1.ProduceRequest:
+			return srv.Produce(ctx, req)
+		case *v1.ConsumeRequest:
+			return srv.Consume(ctx, req)
+		}
+
+		return nil, status.Errorf(codes.Unimplemented, "method %s is not served", method)
+	})
+}
+
+// error writes the status of the error as JSON.
+func (self *gateway) error(w http.ResponseWriter, err error, offsets []uint64) {
+	code := http.StatusInternalServerError
+
+	var outOfRange ErrOffsetOutOfRange
+	if errors.As(err, &outOfRange) {
+		// the records below the lowest offset were removed,
+		// the ones above the highest aren't written yet
+		code = http.StatusNotFound
+		if lowest, lerr := self.config.CommitLog.LowestOffset(); lerr == nil && outOfRange.Offset < lowest {
+			code = http.StatusRequestedRangeNotSatisfiable
+		}
+	}
+
+	st := status.Convert(err)
+	if code == http.StatusInternalServerError {
+		code = httpStatus(st.Code())
+	}
+
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			seconds := math.Ceil(info.RetryDelay.AsDuration().Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+		}
+	}
+
+	self.json(w, code, gatewayError{
+		Error:   st.Message(),
+		Code:    st.Code().String(),
+		Offsets: offsets,
+	})
+}
+
+func (self *gateway) json(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// httpStatus maps the gRPC codes to the HTTP statuses.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.OutOfRange:
+		return http.StatusRequestedRangeNotSatisfiable
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499
+	}
+
+	return http.StatusInternalServerError
+}
+
+// remoteAddr parses the address of the client, for the audit log.
+func remoteAddr(addr string) net.Addr {
+	a, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil
+	}
+	return a
+}
@@ -0,0 +1,148 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/authn"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// memLog keeps the records in memory.
+type memLog struct {
+	mu      sync.Mutex
+	records []*v1.Record
+}
+
+func (self *memLog) Append(record *v1.Record) (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	record = proto.Clone(record).(*v1.Record)
+	record.Offset = uint64(len(self.records))
+	self.records = append(self.records, record)
+
+	return record.Offset, nil
+}
+
+func (self *memLog) Read(offset uint64) (*v1.Record, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if offset >= uint64(len(self.records)) {
+		return nil, ErrOffsetOutOfRange{Offset: offset}
+	}
+	return self.records[offset], nil
+}
+
+func (self *memLog) LowestOffset() (uint64, error) { return 0, nil }
+
+func (self *memLog) HighestOffset() (uint64, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(self.records) == 0 {
+		return 0, nil
+	}
+	return uint64(len(self.records)) - 1, nil
+}
+
+func (self *memLog) Checksum(start, end uint64) (uint64, uint64, error) { return 0, 0, nil }
+
+// allow lets every subject do everything.
+type allow struct{}
+
+func (allow) Authorize(subject, object, action string) error { return nil }
+
+// anonymous authenticates every request as root.
+type anonymous struct{}
+
+func (anonymous) Authenticate(ctx context.Context) (string, error) { return "root", nil }
+
+func newGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	c := &Config{
+		CommitLog:      &memLog{},
+		Authorize:      allow{},
+		Authenticators: []authn.Authenticator{anonymous{}},
+	}
+	if _, err := New(c); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewGateway(c))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestGatewayKeepsBinaryValues(t *testing.T) {
+	srv := newGateway(t)
+
+	value := []byte{0x00, 0xff, 0xfe, 'h', 'i', 0x80}
+	body, err := json.Marshal(gatewayRecord{Value: value})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Post(srv.URL+"/v1/records", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("produce: got %d", res.StatusCode)
+	}
+
+	res, err = http.Get(srv.URL + "/v1/records/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var record gatewayRecord
+	if err := json.NewDecoder(res.Body).Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(record.Value, value) {
+		t.Fatalf("got %x, want %x", record.Value, value)
+	}
+}
+
+func TestGatewayLimitsBodies(t *testing.T) {
+	srv := newGateway(t)
+
+	// a batch of small records larger than a gRPC message
+	var body bytes.Buffer
+	line := fmt.Sprintf("{\"value\":%q}\n", bytes.Repeat([]byte("a"), 1<<10))
+	for body.Len() <= maxBodyBytes {
+		body.WriteString(line)
+	}
+
+	res, err := http.Post(srv.URL+"/v1/records", ndjsonContentType, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %d, want %d", res.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	var gerr gatewayError
+	if err := json.NewDecoder(res.Body).Decode(&gerr); err != nil {
+		t.Fatal(err)
+	}
+	if len(gerr.Offsets) == 0 {
+		t.Fatal("the records before the limit were not reported")
+	}
+}
@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"sync"
+
+	"github.com/hashicorp/serf/serf"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+/*
+The serving status of the node is published with the standard
+grpc.health.v1 service, so load balancers and grpcurl can probe it.
+The Log service, and the server as a whole, serve once the log is
+open and the local member is alive in the cluster, until the node
+drains, leaves or closes the log.
+The Admin service serves as long as the log is open, so a draining
+node can still be watched. Probes skip the authenticators, though
+the TLS settings still apply to their connections.
+*/
+
+// health tracks the readiness of the node.
+type health struct {
+	*grpchealth.Server
+
+	mu       sync.Mutex
+	logOpen  bool
+	joined   bool
+	draining bool
+}
+
+func newHealth(logOpen bool) *health {
+	h := &health{
+		Server:  grpchealth.NewServer(),
+		logOpen: logOpen,
+	}
+	h.update()
+
+	return h
+}
+
+// AuthFuncOverride lets the probes in without authentication.
+func (self *health) AuthFuncOverride(ctx context.Context, fullMethodName string) (context.Context, error) {
+	return ctx, nil
+}
+
+func (self *health) setLogOpen(open bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.logOpen = open
+	self.update()
+}
+
+func (self *health) setJoined(joined bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.joined = joined
+	self.update()
+}
+
+func (self *health) setDraining(draining bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.draining = draining
+	self.update()
+}
+
+// update publishes the status of the services, the lock must be held.
+func (self *health) update() {
+	admin := healthpb.HealthCheckResponse_NOT_SERVING
+	if self.logOpen {
+		admin = healthpb.HealthCheckResponse_SERVING
+	}
+
+	log := healthpb.HealthCheckResponse_NOT_SERVING
+	if self.logOpen && self.joined && !self.draining {
+		log = healthpb.HealthCheckResponse_SERVING
+	}
+
+	self.SetServingStatus("", log)
+	self.SetServingStatus(v1.Log_ServiceDesc.ServiceName, log)
+	self.SetServingStatus(v1.Admin_ServiceDesc.ServiceName, admin)
+}
+
+// SetJoined publishes whether the node is a member of the cluster,
+// the Log service doesn't serve until it joined.
+func (self *Config) SetJoined(joined bool) {
+	if self.health != nil {
+		self.health.setJoined(joined)
+	}
+}
+
+// SetLogOpen publishes whether the log is open, neither service
+// serves once it's closed.
+func (self *Config) SetLogOpen(open bool) {
+	if self.health != nil {
+		self.health.setLogOpen(open)
+	}
+}
+
+// FollowMembership publishes the node as joined while its member
+// is alive in the cluster, until the returned function is called.
+// Without a cluster, e.g. static or dns discovery, it's joined for good.
+func (self *Config) FollowMembership() func() {
+	if self.Cluster == nil {
+		self.SetJoined(true)
+		return func() {}
+	}
+
+	changes, stop := self.Cluster.Watch()
+	alive := func() {
+		self.SetJoined(self.Cluster.LocalMember().Status == serf.StatusAlive)
+	}
+	alive()
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-changes:
+				alive()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stop()
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+
+	"github.com/hashicorp/serf/serf"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	serving    = healthpb.HealthCheckResponse_SERVING
+	notServing = healthpb.HealthCheckResponse_NOT_SERVING
+)
+
+// servingStatuses are the statuses of the server, the Log and the Admin services.
+type servingStatuses [3]healthpb.HealthCheckResponse_ServingStatus
+
+func statuses(t *testing.T, h *health) servingStatuses {
+	t.Helper()
+
+	var got servingStatuses
+	for i, service := range []string{"", v1.Log_ServiceDesc.ServiceName, v1.Admin_ServiceDesc.ServiceName} {
+		res, err := h.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[i] = res.Status
+	}
+
+	return got
+}
+
+func TestHealthTransitions(t *testing.T) {
+	h := newHealth(true)
+
+	steps := []struct {
+		name   string
+		change func()
+		want   servingStatuses
+	}{
+		{"log open", func() {}, servingStatuses{notServing, notServing, serving}},
+		{"joined", func() { h.setJoined(true) }, servingStatuses{serving, serving, serving}},
+		{"draining", func() { h.setDraining(true) }, servingStatuses{notServing, notServing, serving}},
+		{"drain aborted", func() { h.setDraining(false) }, servingStatuses{serving, serving, serving}},
+		{"left", func() { h.setJoined(false) }, servingStatuses{notServing, notServing, serving}},
+		{"rejoined", func() { h.setJoined(true) }, servingStatuses{serving, serving, serving}},
+		{"log closed", func() { h.setLogOpen(false) }, servingStatuses{notServing, notServing, notServing}},
+	}
+
+	for _, step := range steps {
+		step.change()
+		if got := statuses(t, h); got != step.want {
+			t.Fatalf("%s: got %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+// cluster is a membership whose local member changes status.
+type cluster struct {
+	mu      sync.Mutex
+	status  serf.MemberStatus
+	changes chan struct{}
+}
+
+func (self *cluster) Members() []serf.Member { return []serf.Member{self.LocalMember()} }
+
+func (self *cluster) LocalMember() serf.Member {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return serf.Member{Name: "node-0", Status: self.status}
+}
+
+func (self *cluster) Watch() (<-chan struct{}, func()) { return self.changes, func() {} }
+
+func (self *cluster) set(status serf.MemberStatus) {
+	self.mu.Lock()
+	self.status = status
+	self.mu.Unlock()
+
+	self.changes <- struct{}{}
+}
+
+func TestFollowMembership(t *testing.T) {
+	c := &cluster{status: serf.StatusAlive, changes: make(chan struct{})}
+	config := &Config{Cluster: c, health: newHealth(true)}
+
+	stop := config.FollowMembership()
+	defer stop()
+
+	waitStatus := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+
+		deadline := time.Now().Add(time.Second)
+		for statuses(t, config.health)[1] != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("log service is not %s", want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitStatus(serving)
+
+	// leaving, e.g. through Drain, stops the Log service
+	c.set(serf.StatusLeaving)
+	waitStatus(notServing)
+
+	c.set(serf.StatusAlive)
+	waitStatus(serving)
+}
+
+func TestFollowMembershipWithoutCluster(t *testing.T) {
+	config := &Config{health: newHealth(true)}
+	config.FollowMembership()()
+
+	if got := statuses(t, config.health)[1]; got != serving {
+		t.Fatalf("got %s, want %s", got, serving)
+	}
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"logger/internal/domain"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LogAdmin manages the segments and topics of the log.
+type LogAdmin interface {
+	Segments() []domain.Segment
+	Roll() (uint64, error)
+	Truncate(lowest uint64) error
+	Topics() ([]domain.Topic, error)
+	TopicDeleted(name string) (bool, error)
+	CreateTopic(name string) (uint64, error)
+	DeleteTopic(name string) (uint64, error)
+}
+
+// errNoLogAdmin is returned when the log can't be managed
+var errNoLogAdmin = status.Error(codes.Unavailable, "log management is not configured")
+
+// DescribeLog returns the offsets, segments and topics of the log.
+func (self *AdminServer) DescribeLog(ctx context.Context, req *v1.DescribeLogRequest) (*v1.DescribeLogResponse, error) {
+	if err := self.authorizeLog(ctx); err != nil {
+		return nil, err
+	}
+
+	lowest, err := self.CommitLog.LowestOffset()
+	if err != nil {
+		return nil, err
+	}
+	highest, err := self.CommitLog.HighestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := self.Logs.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.DescribeLogResponse{
+		LowestOffset:  lowest,
+		HighestOffset: highest,
+	}
+	for _, s := range self.Logs.Segments() {
+		res.Segments = append(res.Segments, &v1.SegmentInfo{
+			BaseOffset:    s.BaseOffset,
+			NextOffset:    s.NextOffset,
+			StoreBytes:    s.StoreBytes,
+			IndexBytes:    s.IndexBytes,
+			MaxIndexBytes: s.MaxIndexBytes,
+			Active:        s.Active,
+		})
+	}
+	for _, t := range topics {
+		res.Topics = append(res.Topics, &v1.TopicInfo{
+			Name:      t.Name,
+			CreatedAt: t.CreatedAt,
+			Deleted:   t.Deleted,
+			DeletedAt: t.DeletedAt,
+		})
+	}
+
+	return res, nil
+}
+
+// RollSegment seals the active segment of the node.
+func (self *AdminServer) RollSegment(ctx context.Context, req *v1.RollSegmentRequest) (*v1.RollSegmentResponse, error) {
+	if err := self.authorizeLog(ctx); err != nil {
+		return nil, err
+	}
+
+	base, err := self.Logs.Roll()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.RollSegmentResponse{BaseOffset: base}, nil
+}
+
+// Truncate removes the segments of the node below the offset.
+func (self *AdminServer) Truncate(ctx context.Context, req *v1.TruncateRequest) (*v1.TruncateResponse, error) {
+	if err := self.authorizeLog(ctx); err != nil {
+		return nil, err
+	}
+
+	err := self.Logs.Truncate(req.LowestOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	lowest, err := self.CommitLog.LowestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.TruncateResponse{LowestOffset: lowest}, nil
+}
+
+// CreateTopic registers a topic, the change is replicated with the log.
+func (self *AdminServer) CreateTopic(ctx context.Context, req *v1.TopicRequest) (*v1.TopicResponse, error) {
+	return self.changeTopic(ctx, req.Topic, LogAdmin.CreateTopic)
+}
+
+// DeleteTopic rejects the records produced to a topic from now on.
+func (self *AdminServer) DeleteTopic(ctx context.Context, req *v1.TopicRequest) (*v1.TopicResponse, error) {
+	return self.changeTopic(ctx, req.Topic, LogAdmin.DeleteTopic)
+}
+
+func (self *AdminServer) changeTopic(
+	ctx context.Context,
+	topic string,
+	change func(LogAdmin, string) (uint64, error),
+) (*v1.TopicResponse, error) {
+	err := self.authorize(ctx, topicObject(topic), adminAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Logs == nil {
+		return nil, errNoLogAdmin
+	}
+
+	off, err := change(self.Logs, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.TopicResponse{Offset: off}, nil
+}
+
+// authorizeLog checks that the subject administers the log.
+func (self *AdminServer) authorizeLog(ctx context.Context) error {
+	err := self.authorize(ctx, logObject, adminAction)
+	if err != nil {
+		return err
+	}
+
+	if self.Logs == nil {
+		return errNoLogAdmin
+	}
+
+	return nil
+}
+
+// checkTopic rejects the records of deleted topics.
+func (self *Config) checkTopic(topic string) error {
+	if self.Logs == nil {
+		return nil
+	}
+
+	deleted, err := self.Logs.TopicDeleted(topic)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return status.Errorf(codes.FailedPrecondition, "topic %q is deleted", topic)
+	}
+
+	return nil
+}
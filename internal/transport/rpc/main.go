@@ -3,21 +3,36 @@ package rpc
 import (
 	"context"
 	v1 "logger/gen/go/v1"
+	"logger/internal/domain"
+	"logger/internal/service/auth"
+	"logger/internal/service/authn"
 
+	"github.com/hashicorp/serf/serf"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/peer"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
 )
 
+// objects are the topics and resources that are authorized
+const (
+	topicObjectPrefix = "topic/"
+	clusterObject     = "cluster"
+	logObject         = "log"
+	keyringObject     = "keyring"
+	aclObject         = "acl"
+)
+
 const (
-	objectWildcard = "*"
 	produceAction  = "produce"
 	consumeAction  = "consume"
+	describeAction = "describe"
+	repairAction   = "repair"
+	adminAction    = "admin"
 )
 
 var _ v1.LogServer = (*GRPCServer)(nil)
@@ -26,32 +41,100 @@ type Authorizer interface {
 	Authorize(subject, object, action string) error
 }
 
+// AnyAuthorizer is implemented by the authorizers that can tell
+// whether the subject may do the action on some object of a prefix.
+type AnyAuthorizer interface {
+	AuthorizeAny(subject, prefix, action string) error
+}
+
 type CommitLog interface {
 	Append(*v1.Record) (uint64, error)
 	Read(uint64) (*v1.Record, error)
+	LowestOffset() (uint64, error)
+	HighestOffset() (uint64, error)
+	Checksum(start, end uint64) (uint64, uint64, error)
+}
+
+// Cluster returns the members known to discovery.
+type Cluster interface {
+	Members() []serf.Member
+	LocalMember() serf.Member
+	// Watch signals the membership changes until it's stopped
+	Watch() (<-chan struct{}, func())
+}
+
+// Replication returns the replication state of every source.
+type Replication interface {
+	Peers() []domain.Peer
+}
+
+// Verifier compares the local log with the logs of other nodes.
+type Verifier interface {
+	Verify(ctx context.Context, addr string, repair bool) []*v1.Verification
 }
 
 type SubjectContextKey struct{}
 
 type Config struct {
-	CommitLog CommitLog
-	Authorize Authorizer
+	CommitLog   CommitLog
+	Authorize   Authorizer
+	Cluster     Cluster
+	Replication Replication
+	Verifier    Verifier
+	Keyring     Keyring
+	Membership  Membership
+	Commands    Commands
+	Policy      Policy
+	Revocations Revocations
+	// Reloader applies the changes of the configuration file
+	Reloader Reloader
+	// Logs manages the segments and topics of the log
+	Logs LogAdmin
+	// Authenticators are tried in order to find the subject
+	// of a call, only mTLS is enabled when it's empty
+	Authenticators []authn.Authenticator
+	// Audit records the authorization decisions when it's set
+	Audit Auditor
+	// Quota limits the produced and consumed records of the subjects
+	Quota Limiter
+	// DialOptions are used to ask the other members for their status
+	DialOptions []grpc.DialOption
+	// ReplicatorSubject is the subject of the local replicator,
+	// which keeps producing the records of the other nodes while
+	// the node drains
+	ReplicatorSubject string
+
+	health *health
+	// server serves the Log service to the gateway
+	server *GRPCServer
 }
 
 type GRPCServer struct {
-	*v1.UnimplementedLogServer
+	v1.UnimplementedLogServer
 	*Config
+
+	drain *drainer
 }
 
 func New(config *Config, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	if len(config.Authenticators) == 0 {
+		config.Authenticators = []authn.Authenticator{authn.MTLS{}}
+	}
+	authenticate := config.authenticate
+	config.health = newHealth(config.CommitLog != nil)
+
 	opts = append(opts,
 		grpc.StreamInterceptor(
 			grpc_middleware.ChainStreamServer(
 				grpc_auth.StreamServerInterceptor(authenticate),
+				config.quotaStream,
 			)),
 		grpc.UnaryInterceptor(
-			grpc_auth.UnaryServerInterceptor(authenticate),
-		),
+			grpc_middleware.ChainUnaryServer(
+				grpc_auth.UnaryServerInterceptor(authenticate),
+				config.auditAdmin,
+				config.quotaUnary,
+			)),
 	)
 	gsrv := grpc.NewServer(opts...)
 	srt, err := new(config)
@@ -59,7 +142,11 @@ func New(config *Config, opts ...grpc.ServerOption) (*grpc.Server, error) {
 		return nil, err
 	}
 
+	config.server = srt
 	v1.RegisterLogServer(gsrv, srt)
+	v1.RegisterAdminServer(gsrv, &AdminServer{Config: config, drain: srt.drain})
+	healthpb.RegisterHealthServer(gsrv, config.health)
+	reflection.Register(gsrv)
 
 	return gsrv, nil
 }
@@ -67,21 +154,30 @@ func New(config *Config, opts ...grpc.ServerOption) (*grpc.Server, error) {
 func new(config *Config) (srv *GRPCServer, err error) {
 	srv = &GRPCServer{
 		Config: config,
+		drain:  &drainer{},
 	}
 
 	return srv, nil
 }
 
 func (self *GRPCServer) Produce(ctx context.Context, req *v1.ProduceRequest) (*v1.ProduceResponse, error) {
-	err := self.Authorize.Authorize(
-		subject(ctx),
-		objectWildcard,
-		produceAction,
+	err := self.authorize(
+		ctx,
+		topicObject(req.Record.GetTopic()),
+		topicAction(req.Record.GetTopic(), produceAction),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if self.drain.draining.Load() && !self.replicating(ctx) {
+		return nil, errDraining
+	}
+
+	if err := self.checkTopic(req.Record.GetTopic()); err != nil {
+		return nil, err
+	}
+
 	offset, err := self.Config.CommitLog.Append(req.Record)
 	if err != nil {
 		return nil, err
@@ -91,15 +187,14 @@ func (self *GRPCServer) Produce(ctx context.Context, req *v1.ProduceRequest) (*v
 }
 
 func (self *GRPCServer) Consume(ctx context.Context, req *v1.ConsumeRequest) (*v1.ConsumeResponse, error) {
-	err := self.Authorize.Authorize(
-		subject(ctx),
-		objectWildcard,
-		consumeAction,
-	)
+	// the record isn't read before the subject may consume a topic,
+	// not to tell it which offsets exist
+	err := self.authorizeTopics(ctx, consumeAction)
 	if err != nil {
 		return nil, err
 	}
-	record, err := self.Config.CommitLog.Read(req.Offset)
+
+	record, err := self.consume(ctx, req.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -107,6 +202,27 @@ func (self *GRPCServer) Consume(ctx context.Context, req *v1.ConsumeRequest) (*v
 	return &v1.ConsumeResponse{Record: record}, nil
 }
 
+// consume reads the record at the offset if the subject
+// may consume its topic.
+func (self *GRPCServer) consume(ctx context.Context, offset uint64) (*v1.Record, error) {
+	record, err := self.Config.CommitLog.Read(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	// the topic is known once the record is read
+	err = self.authorize(
+		ctx,
+		topicObject(record.Topic),
+		topicAction(record.Topic, consumeAction),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
 func (self *GRPCServer) ProduceStream(stream v1.Log_ProduceStreamServer) error {
 	for {
 		req, err := stream.Recv()
@@ -130,46 +246,69 @@ func (self *GRPCServer) ConsumeStream(
 	req *v1.ConsumeRequest,
 	stream v1.Log_ConsumeStreamServer,
 ) error {
+	// a subject that can't consume any topic would get an endless
+	// empty stream, the records of the other topics are skipped
+	err := self.authorizeTopics(stream.Context(), consumeAction)
+	if err != nil {
+		return err
+	}
+
+	id := self.drain.open(req.Offset)
+	defer self.drain.close(id)
+
 	for {
 		select {
 		case <-stream.Context().Done():
 			return nil
 		default:
-			res, err := self.Consume(stream.Context(), req)
+			record, err := self.consume(stream.Context(), req.Offset)
 			switch err.(type) {
 			case nil:
 			case ErrOffsetOutOfRange:
 				continue
 			default:
+				// skip the records of topics the subject can't consume
+				if status.Code(err) == codes.PermissionDenied {
+					req.Offset++
+					self.drain.progress(id, req.Offset)
+					continue
+				}
 				return err
 			}
 
-			err = stream.Send(res)
+			err = stream.Send(&v1.ConsumeResponse{Record: record})
 			if err != nil {
 				return err
 			}
 
 			req.Offset++
+			self.drain.progress(id, req.Offset)
 		}
 	}
 }
 
-// Get peer info from context and validate it.
-func authenticate(ctx context.Context) (context.Context, error) {
-	peer, ok := peer.FromContext(ctx)
-	if !ok {
-		return nil, status.Error(codes.Unknown, "couldn't find peer info")
+// authenticate finds the subject of the call with the authenticators.
+func (self *Config) authenticate(ctx context.Context) (context.Context, error) {
+	subject, err := authn.Authenticate(ctx, self.Authenticators)
+	if err != nil {
+		return nil, err
 	}
 
-	if peer.AuthInfo == nil {
-		return nil, status.Error(codes.Unauthenticated, "missing credentials")
-	}
+	return context.WithValue(ctx, SubjectContextKey{}, subject), nil
+}
 
-	tlsInfo := peer.AuthInfo.(credentials.TLSInfo)
-	subject := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
-	ctx = context.WithValue(ctx, SubjectContextKey{}, subject)
+// topicObject returns the object name of a topic.
+func topicObject(topic string) string {
+	return topicObjectPrefix + topic
+}
 
-	return ctx, nil
+// topicAction returns the action authorized on a topic,
+// system topics are reserved for admins.
+func topicAction(topic, action string) string {
+	if auth.IsSystemTopic(topic) {
+		return adminAction
+	}
+	return action
 }
 
 func subject(ctx context.Context) string {
@@ -0,0 +1,160 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"logger/internal/service/quota"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Limiter enforces the quotas of the subjects.
+type Limiter interface {
+	Allow(subject, op string) (time.Duration, bool)
+	Charge(subject, op string, records, bytes int)
+}
+
+// quotaUnary enforces the quotas of Produce and Consume.
+func (self *Config) quotaUnary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if self.Quota == nil {
+		return handler(ctx, req)
+	}
+
+	var op string
+	switch info.FullMethod {
+	case v1.Log_Produce_FullMethodName:
+		op = quota.Produce
+	case v1.Log_Consume_FullMethodName:
+		op = quota.Consume
+	default:
+		return handler(ctx, req)
+	}
+
+	sub := subject(ctx)
+	if err := self.allow(sub, op); err != nil {
+		return nil, err
+	}
+
+	res, err := handler(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case quota.Produce:
+		self.Quota.Charge(sub, op, 1, proto.Size(req.(*v1.ProduceRequest).Record))
+	case quota.Consume:
+		self.Quota.Charge(sub, op, 1, proto.Size(res.(*v1.ConsumeResponse).Record))
+	}
+
+	return res, nil
+}
+
+// quotaStream enforces the quotas of the produce and consume streams.
+func (self *Config) quotaStream(
+	srv any,
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if self.Quota == nil {
+		return handler(srv, stream)
+	}
+
+	switch info.FullMethod {
+	case v1.Log_ProduceStream_FullMethodName,
+		v1.Log_ConsumeStream_FullMethodName,
+		v1.Log_ConsumeBatchStream_FullMethodName:
+		return handler(srv, &quotaStream{
+			ServerStream: stream,
+			config:       self,
+			subject:      subject(stream.Context()),
+		})
+	}
+
+	return handler(srv, stream)
+}
+
+// allow returns ResourceExhausted with the delay to retry after
+// when the subject is over its quota.
+func (self *Config) allow(subject, op string) error {
+	wait, ok := self.Quota.Allow(subject, op)
+	if ok {
+		return nil
+	}
+
+	st := status.Newf(codes.ResourceExhausted, "%s is over its %s quota", subject, op)
+	std, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(wait),
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return std.Err()
+}
+
+// quotaStream charges the records received and sent on a stream.
+type quotaStream struct {
+	grpc.ServerStream
+	config  *Config
+	subject string
+}
+
+func (self *quotaStream) RecvMsg(m any) error {
+	req, ok := m.(*v1.ProduceRequest)
+	if !ok {
+		return self.ServerStream.RecvMsg(m)
+	}
+
+	if err := self.config.allow(self.subject, quota.Produce); err != nil {
+		return err
+	}
+
+	if err := self.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	self.config.Quota.Charge(self.subject, quota.Produce, 1, proto.Size(req.Record))
+
+	return nil
+}
+
+func (self *quotaStream) SendMsg(m any) error {
+	var records []*v1.Record
+	switch res := m.(type) {
+	case *v1.ConsumeResponse:
+		records = []*v1.Record{res.Record}
+	case *v1.ConsumeBatchResponse:
+		records = res.Records
+	default:
+		return self.ServerStream.SendMsg(m)
+	}
+
+	if err := self.config.allow(self.subject, quota.Consume); err != nil {
+		return err
+	}
+
+	if err := self.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+
+	var bytes int
+	for _, r := range records {
+		bytes += proto.Size(r)
+	}
+	self.config.Quota.Charge(self.subject, quota.Consume, len(records), bytes)
+
+	return nil
+}
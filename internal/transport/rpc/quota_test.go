@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "logger/gen/go/v1"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// limiter allows the calls unless it has a wait, and records the charges.
+type limiter struct {
+	wait    time.Duration
+	charged []int
+}
+
+func (self *limiter) Allow(subject, op string) (time.Duration, bool) {
+	return self.wait, self.wait == 0
+}
+
+func (self *limiter) Charge(subject, op string, records, bytes int) {
+	self.charged = append(self.charged, records, bytes)
+}
+
+func TestQuotaUnary(t *testing.T) {
+	record := &v1.Record{Value: []byte("hello")}
+	req := &v1.ProduceRequest{Record: record}
+	info := &grpc.UnaryServerInfo{FullMethod: v1.Log_Produce_FullMethodName}
+	ctx := context.WithValue(context.Background(), SubjectContextKey{}, "alice")
+
+	tests := []struct {
+		name        string
+		wait        time.Duration
+		wantCode    codes.Code
+		wantCharged []int
+	}{
+		{
+			name:        "allowed calls are charged",
+			wantCode:    codes.OK,
+			wantCharged: []int{1, proto.Size(record)},
+		},
+		{
+			name:     "calls over the quota are exhausted",
+			wait:     1500 * time.Millisecond,
+			wantCode: codes.ResourceExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &limiter{wait: tt.wait}
+			config := &Config{Quota: l}
+
+			called := false
+			_, err := config.quotaUnary(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				called = true
+				return &v1.ProduceResponse{}, nil
+			})
+
+			st := status.Convert(err)
+			if st.Code() != tt.wantCode {
+				t.Fatalf("got %s, want %s", st.Code(), tt.wantCode)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Fatalf("handler called: %t", called)
+			}
+			if fmt.Sprint(l.charged) != fmt.Sprint(tt.wantCharged) {
+				t.Fatalf("charged %v, want %v", l.charged, tt.wantCharged)
+			}
+
+			if tt.wait == 0 {
+				return
+			}
+
+			var info *errdetails.RetryInfo
+			for _, d := range st.Details() {
+				if d, ok := d.(*errdetails.RetryInfo); ok {
+					info = d
+				}
+			}
+			if info == nil {
+				t.Fatal("no retry info")
+			}
+			if got := info.RetryDelay.AsDuration(); got != tt.wait {
+				t.Fatalf("retry delay %v, want %v", got, tt.wait)
+			}
+		})
+	}
+}
+
+func TestQuotaUnaryIgnoresOtherMethods(t *testing.T) {
+	config := &Config{Quota: &limiter{wait: time.Second}}
+	info := &grpc.UnaryServerInfo{FullMethod: v1.Log_GetServers_FullMethodName}
+
+	_, err := config.quotaUnary(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,34 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reloader reloads the configuration of the node.
+type Reloader interface {
+	Reload() ([]string, error)
+}
+
+// ReloadConfig applies the changes of the configuration file to the node.
+// It fails without applying anything when a change needs a restart.
+func (self *AdminServer) ReloadConfig(ctx context.Context, req *v1.ReloadConfigRequest) (*v1.ReloadConfigResponse, error) {
+	err := self.authorize(ctx, clusterObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Reloader == nil {
+		return nil, status.Error(codes.Unavailable, "config reload is not configured")
+	}
+
+	applied, err := self.Reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.ReloadConfigResponse{Applied: applied}, nil
+}
@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// certObject is the object of the certificate revocations
+const certObject = "cert"
+
+// names of the cluster-wide revocation commands
+const (
+	revokeCommand   = "revoke-cert"
+	unrevokeCommand = "unrevoke-cert"
+)
+
+// Revocations holds the revoked client certificates of the node.
+type Revocations interface {
+	Revoke(serial string) error
+	Unrevoke(serial string) error
+	Serials() []string
+}
+
+// Revoke revokes a certificate on every member of the cluster.
+func (self *AdminServer) Revoke(ctx context.Context, req *v1.RevokeRequest) (*v1.RevokeResponse, error) {
+	return self.revoke(ctx, revokeCommand, req.Serial, Revocations.Revoke)
+}
+
+// Unrevoke lifts the revocation of a certificate on every member of the cluster.
+func (self *AdminServer) Unrevoke(ctx context.Context, req *v1.RevokeRequest) (*v1.RevokeResponse, error) {
+	return self.revoke(ctx, unrevokeCommand, req.Serial, Revocations.Unrevoke)
+}
+
+// ListRevoked returns the certificates revoked on the node.
+func (self *AdminServer) ListRevoked(ctx context.Context, req *v1.ListRevokedRequest) (*v1.ListRevokedResponse, error) {
+	err := self.authorize(ctx, certObject, describeAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Revocations == nil {
+		return nil, errNoRevocations
+	}
+
+	return &v1.ListRevokedResponse{Serials: self.Revocations.Serials()}, nil
+}
+
+// errNoRevocations is returned when revocation is not configured
+var errNoRevocations = status.Error(codes.Unavailable, "certificate revocation is not configured")
+
+// revoke broadcasts the command to the members,
+// without discovery it edits the revocations of the node only.
+func (self *AdminServer) revoke(
+	ctx context.Context,
+	command string,
+	serial string,
+	local func(r Revocations, serial string) error,
+) (*v1.RevokeResponse, error) {
+	err := self.authorize(ctx, certObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Revocations == nil {
+		return nil, errNoRevocations
+	}
+
+	res := &v1.RevokeResponse{}
+	if self.Commands == nil {
+		result := &v1.CommandResult{Node: hostname(), Output: "done"}
+		if err := local(self.Revocations, serial); err != nil {
+			result.Output, result.Error = "", err.Error()
+		}
+		res.Results = append(res.Results, result)
+
+		return res, nil
+	}
+
+	results, err := self.Commands.Broadcast(command, []byte(serial), true, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		res.Results = append(res.Results, &v1.CommandResult{
+			Node:   r.Node,
+			Output: r.Output,
+			Error:  r.Error,
+		})
+	}
+
+	return res, nil
+}
+
+// hostname names the node in the results without discovery.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "local"
+	}
+	return name
+}
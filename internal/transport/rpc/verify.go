@@ -0,0 +1,96 @@
+package rpc
+
+import (
+	"context"
+	v1 "logger/gen/go/v1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OwnLog is implemented by the logs that keep the origin of their
+// records, to tell the records produced to the node from the replicated ones.
+type OwnLog interface {
+	Origin() string
+	OwnChecksum(start, end uint64) (uint64, uint64, error)
+}
+
+// Checksum returns the rolling checksum of a range of records,
+// so other nodes can compare it with their own.
+func (self *GRPCServer) Checksum(
+	ctx context.Context,
+	req *v1.ChecksumRequest,
+) (*v1.ChecksumResponse, error) {
+	err := self.authorize(
+		ctx,
+		logObject,
+		describeAction,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := self.CommitLog.Checksum
+	var origin string
+	if req.Own {
+		own, ok := self.CommitLog.(OwnLog)
+		if !ok {
+			return nil, status.Error(codes.Unimplemented, "the log doesn't keep the origin of its records")
+		}
+		checksum = own.OwnChecksum
+		origin = own.Origin()
+	}
+
+	sum, count, err := checksum(req.StartOffset, req.EndOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	lowest, err := self.CommitLog.LowestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	highest, err := self.CommitLog.HighestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := nextOffset(self.CommitLog)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.ChecksumResponse{
+		Checksum:      sum,
+		Count:         count,
+		LowestOffset:  lowest,
+		HighestOffset: highest,
+		Origin:        origin,
+		NextOffset:    next,
+	}, nil
+}
+
+// Verify compares the local log with other nodes on demand.
+func (self *GRPCServer) Verify(
+	ctx context.Context,
+	req *v1.VerifyRequest,
+) (*v1.VerifyResponse, error) {
+	action := describeAction
+	if req.Repair {
+		action = repairAction
+	}
+
+	err := self.authorize(ctx, logObject, action)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Verifier == nil {
+		return nil, status.Error(codes.Unavailable, "verifier is not configured")
+	}
+
+	return &v1.VerifyResponse{
+		Verifications: self.Verifier.Verify(ctx, req.RpcAddr, req.Repair),
+	}, nil
+}